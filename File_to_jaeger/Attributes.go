@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// warnf reports a problem that does not stop a span from being converted.
+var warnf = func(format string, args ...interface{}) {
+	log.Printf("warning: "+format, args...)
+}
+
+// attrValue converts one attribute as written by stdouttrace. The decoder
+// yields json.Number for numbers and []interface{} for arrays, so every
+// value is checked and converted rather than type asserted.
+func attrValue(kv KeyValue1) (attribute.KeyValue, error) {
+	k, v := kv.Key, kv.Value.Value
+	switch kv.Value.Type {
+	case "BOOL":
+		b, err := toBool(v)
+		return attribute.Bool(k, b), err
+	case "BOOLSLICE":
+		b, err := toSlice(v, toBool)
+		return attribute.BoolSlice(k, b), err
+	case "INT64":
+		n, err := toInt64(v)
+		return attribute.Int64(k, n), err
+	case "INT64SLICE":
+		n, err := toSlice(v, toInt64)
+		return attribute.Int64Slice(k, n), err
+	case "FLOAT64":
+		f, err := toFloat64(v)
+		return attribute.Float64(k, f), err
+	case "FLOAT64SLICE":
+		f, err := toSlice(v, toFloat64)
+		return attribute.Float64Slice(k, f), err
+	case "STRING":
+		s, err := toString(v)
+		return attribute.String(k, s), err
+	case "STRINGSLICE":
+		s, err := toSlice(v, toString)
+		return attribute.StringSlice(k, s), err
+	}
+	return attribute.KeyValue{}, fmt.Errorf("unknown type %q", kv.Value.Type)
+}
+
+func toBool(v interface{}) (bool, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a bool, got %T", v)
+	}
+	return b, nil
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.Int64()
+	case float64:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	}
+	return 0, fmt.Errorf("expected an integer, got %T", v)
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.Float64()
+	case float64:
+		return n, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+func toString(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string, got %T", v)
+	}
+	return s, nil
+}
+
+// toSlice converts a decoded JSON array element by element. A null array is
+// an empty slice.
+func toSlice[T any](v interface{}, conv func(interface{}) (T, error)) ([]T, error) {
+	if v == nil {
+		return nil, nil
+	}
+	vs, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array, got %T", v)
+	}
+	out := make([]T, len(vs))
+	for i := range vs {
+		var err error
+		if out[i], err = conv(vs[i]); err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// chromeEvent is one event of the Trace Event Format read by chrome://tracing
+// and ui.perfetto.dev. Timestamps are microseconds.
+type chromeEvent struct {
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Phase string                 `json:"ph"`
+	Scope string                 `json:"s,omitempty"`
+	TS    float64                `json:"ts"`
+	Dur   *float64               `json:"dur,omitempty"`
+	PID   int                    `json:"pid"`
+	TID   int                    `json:"tid"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+type chromeFile struct {
+	TraceEvents     []chromeEvent `json:"traceEvents"`
+	DisplayTimeUnit string        `json:"displayTimeUnit"`
+}
+
+// writeChromeTrace writes spans as Trace Event Format JSON with a process per
+// service and complete events for spans, laid out on as few thread lanes as
+// possible: a span shares a lane with the spans it lies within and gets a
+// new one when it overlaps another span only partly. Span events become
+// instant events on the lane of their span. Times count from the earliest
+// span, which keeps sub-microsecond precision in the float timestamps.
+func writeChromeTrace(w io.Writer, spans tracetest.SpanStubs) error {
+	file := chromeFile{TraceEvents: []chromeEvent{}, DisplayTimeUnit: "ms"}
+	if len(spans) == 0 {
+		return json.NewEncoder(w).Encode(file)
+	}
+
+	sorted := append(tracetest.SpanStubs(nil), spans...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if !a.StartTime.Equal(b.StartTime) {
+			return a.StartTime.Before(b.StartTime)
+		}
+		// Of spans starting together the longest goes first, so the
+		// others can nest inside it.
+		return a.EndTime.After(b.EndTime)
+	})
+	origin := sorted[0].StartTime
+	micros := func(t time.Time) float64 { return float64(t.Sub(origin).Nanoseconds()) / 1e3 }
+
+	pids := map[string]int{}
+	lanes := map[int][][]time.Time{} // per process, the end times of the spans open on each lane
+	for _, s := range sorted {
+		svc := serviceName(s)
+		pid, ok := pids[svc]
+		if !ok {
+			pid = len(pids) + 1
+			pids[svc] = pid
+			file.TraceEvents = append(file.TraceEvents, chromeEvent{
+				Name: "process_name", Phase: "M", PID: pid,
+				Args: map[string]interface{}{"name": svc},
+			})
+		}
+
+		tid := placeLane(lanes[pid], s)
+		if tid == len(lanes[pid]) {
+			lanes[pid] = append(lanes[pid], nil)
+			file.TraceEvents = append(file.TraceEvents, chromeEvent{
+				Name: "thread_name", Phase: "M", PID: pid, TID: tid,
+				Args: map[string]interface{}{"name": fmt.Sprintf("lane %d", tid+1)},
+			})
+		}
+		lanes[pid][tid] = append(lanes[pid][tid], s.EndTime)
+
+		dur := float64(s.EndTime.Sub(s.StartTime).Nanoseconds()) / 1e3
+		args := chromeArgs(s.Attributes)
+		args["trace_id"] = s.SpanContext.TraceID().String()
+		args["span_id"] = s.SpanContext.SpanID().String()
+		if s.Parent.IsValid() {
+			args["parent_span_id"] = s.Parent.SpanID().String()
+		}
+		args["kind"] = s.SpanKind.String()
+		args["status"] = s.Status.Code.String()
+		if s.Status.Description != "" {
+			args["status.description"] = s.Status.Description
+		}
+		file.TraceEvents = append(file.TraceEvents, chromeEvent{
+			Name: s.Name, Cat: s.InstrumentationLibrary.Name, Phase: "X",
+			TS: micros(s.StartTime), Dur: &dur, PID: pid, TID: tid, Args: args,
+		})
+		for _, ev := range s.Events {
+			file.TraceEvents = append(file.TraceEvents, chromeEvent{
+				Name: ev.Name, Cat: s.InstrumentationLibrary.Name, Phase: "i", Scope: "t",
+				TS: micros(ev.Time), PID: pid, TID: tid, Args: chromeArgs(ev.Attributes),
+			})
+		}
+	}
+	return json.NewEncoder(w).Encode(file)
+}
+
+// placeLane returns the first lane s fits on, or len(lanes) if it needs a
+// new one. Spans that ended before s starts are closed on the way.
+func placeLane(lanes [][]time.Time, s tracetest.SpanStub) int {
+	for i, open := range lanes {
+		for len(open) > 0 && !open[len(open)-1].After(s.StartTime) {
+			open = open[:len(open)-1]
+		}
+		lanes[i] = open
+		if len(open) == 0 || !open[len(open)-1].Before(s.EndTime) {
+			return i
+		}
+	}
+	return len(lanes)
+}
+
+func chromeArgs(kvs []attribute.KeyValue) map[string]interface{} {
+	args := map[string]interface{}{}
+	for _, kv := range kvs {
+		args[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return args
+}
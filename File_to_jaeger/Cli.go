@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultInput   = "/Traces/finaltrace*.txt"
+	defaultTimeout = 30 * time.Second
+	defaultOutput  = "jaeger"
+	defaultBatch   = 512
+	defaultPoll    = time.Second
+	defaultRetries = 5
+	defaultBackoff = 500 * time.Millisecond
+
+	// defaultDedupWindow keeps deduplication within about 10 MB.
+	defaultDedupWindow = 100000
+
+	// envInput lists the inputs, comma separated, when none are given as
+	// arguments or with -input.
+	envInput = "FILE_TO_JAEGER_INPUT"
+)
+
+const usage = `usage: File_to_jaeger [command] [flags] [input ...]
+
+Commands:
+  export    convert the input files and send the spans to the output (default)
+  validate  decode, convert and check the input files without exporting
+            anything and print a JSON report
+  stats     print span, trace and error counts per service
+  check     group spans into traces and report integrity problems
+
+Inputs may be given as arguments or with -input; "-" reads standard input.
+An input may be a file, a glob or a directory, which stands for the files in it.
+Files compressed with gzip or zstd are decompressed transparently.
+Run "File_to_jaeger <command> -h" for the flags of a command.
+`
+
+type config struct {
+	inputs       []string
+	endpoint     string
+	timeout      time.Duration
+	retries      int
+	retryBackoff time.Duration
+	queue        string
+	spansPerSec  float64
+	bytesPerSec  float64
+	progress     time.Duration
+	output       string
+	batchSize    int
+	follow       bool
+	checkpoint   string
+	poll         time.Duration
+	deadLetter   string
+	merge        bool
+	rotated      bool
+	dedupIndex   string
+	dedupWindow  int
+	filter       filterExpr
+	keepTraces   bool
+	sampler      samplingPolicy
+	rebase       *rebaser
+	columns      []string
+
+	// transforms are applied to every exported span, in order.
+	transforms []func(*tracetest.SpanStub)
+
+	insecure    bool
+	compression string
+}
+
+// commands maps each subcommand to the function that runs it.
+var commands = map[string]func(config) error{
+	"export":   runExport,
+	"validate": runValidate,
+	"stats":    runStats,
+	"check":    runCheck,
+}
+
+// inputList collects the values of a repeated -input flag.
+type inputList []string
+
+func (l *inputList) String() string { return strings.Join(*l, ",") }
+
+func (l *inputList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func run(args []string) int {
+	cmd := "export"
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			cmd, args = args[0], args[1:]
+		} else if args[0] == "help" {
+			fmt.Fprint(os.Stdout, usage)
+			return 0
+		}
+	}
+
+	cfg, err := parseConfig(cmd, args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	if err := commands[cmd](cfg); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// envVars names the environment variable read for each flag that is not
+// given on the command line.
+var envVars = map[string]string{
+	"endpoint":          "FILE_TO_JAEGER_ENDPOINT",
+	"timeout":           "FILE_TO_JAEGER_TIMEOUT",
+	"output":            "FILE_TO_JAEGER_OUTPUT",
+	"batch-size":        "FILE_TO_JAEGER_BATCH_SIZE",
+	"retries":           "FILE_TO_JAEGER_RETRIES",
+	"retry-backoff":     "FILE_TO_JAEGER_RETRY_BACKOFF",
+	"queue":             "FILE_TO_JAEGER_QUEUE",
+	"max-spans-per-sec": "FILE_TO_JAEGER_MAX_SPANS_PER_SEC",
+	"max-bytes-per-sec": "FILE_TO_JAEGER_MAX_BYTES_PER_SEC",
+	"progress":          "FILE_TO_JAEGER_PROGRESS",
+	"follow":            "FILE_TO_JAEGER_FOLLOW",
+	"checkpoint":        "FILE_TO_JAEGER_CHECKPOINT",
+	"poll":              "FILE_TO_JAEGER_POLL",
+	"insecure":          "FILE_TO_JAEGER_INSECURE",
+	"compression":       "FILE_TO_JAEGER_COMPRESSION",
+	"dead-letter":       "FILE_TO_JAEGER_DEAD_LETTER",
+	"merge":             "FILE_TO_JAEGER_MERGE",
+	"rotated":           "FILE_TO_JAEGER_ROTATED",
+	"dedup-index":       "FILE_TO_JAEGER_DEDUP_INDEX",
+	"dedup-window":      "FILE_TO_JAEGER_DEDUP_WINDOW",
+	"filter":            "FILE_TO_JAEGER_FILTER",
+	"keep-traces":       "FILE_TO_JAEGER_KEEP_TRACES",
+	"sample":            "FILE_TO_JAEGER_SAMPLE",
+	"columns":           "FILE_TO_JAEGER_COLUMNS",
+	"rebase":            "FILE_TO_JAEGER_REBASE",
+	"rebase-traces":     "FILE_TO_JAEGER_REBASE_TRACES",
+	"rewrite-rules":     "FILE_TO_JAEGER_REWRITE_RULES",
+	"redact-rules":      "FILE_TO_JAEGER_REDACT_RULES",
+	"redact-key-file":   "FILE_TO_JAEGER_REDACT_KEY_FILE",
+}
+
+// parseConfig parses the flags of cmd. Flags take precedence over the
+// environment, which takes precedence over the built-in defaults.
+func parseConfig(cmd string, args []string) (config, error) {
+	var cfg config
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fmt.Fprintf(fs.Output(), "\nFlags of %s:\n", cmd)
+		fs.PrintDefaults()
+	}
+
+	var inputs inputList
+	fs.Var(&inputs, "input", "trace `file`, glob or directory to read, \"-\" for stdin; repeatable (env "+envInput+", comma separated)")
+	fs.StringVar(&cfg.endpoint, "endpoint", "", "collector endpoint, or file to write for file outputs, \"-\" for standard output (default depends on -output)")
+	fs.DurationVar(&cfg.timeout, "timeout", defaultTimeout, "timeout for each export request")
+	fs.StringVar(&cfg.output, "output", defaultOutput, "where to send spans: jaeger, otlp-grpc, otlp-http, zipkin or stdout, or a file as jaeger-json for Jaeger UI's \"Upload JSON\", otlp-json for the Collector's otlpjsonfile receiver, chrome for chrome://tracing and Perfetto, or csv or ndjson with a row per span")
+	fs.BoolVar(&cfg.insecure, "insecure", false, "use plain text instead of TLS for OTLP endpoints given without a scheme")
+	fs.StringVar(&cfg.compression, "compression", "none", "OTLP payload compression: none or gzip")
+	fs.IntVar(&cfg.batchSize, "batch-size", defaultBatch, "number of spans sent per export request")
+	fs.IntVar(&cfg.retries, "retries", defaultRetries, "how many times a failed export request is retried")
+	fs.DurationVar(&cfg.retryBackoff, "retry-backoff", defaultBackoff, "longest wait before the first retry; doubles with every retry, up to "+maxBackoff.String())
+	fs.Float64Var(&cfg.spansPerSec, "max-spans-per-sec", 0, "limit the export rate to this many spans a second; 0 means no limit")
+	fs.Float64Var(&cfg.bytesPerSec, "max-bytes-per-sec", 0, "limit the export rate to about this many bytes a second, estimated from span names and attributes; 0 means no limit")
+	fs.DurationVar(&cfg.progress, "progress", 0, "log the spans exported so far and the export rate this often; 0 turns it off")
+	fs.StringVar(&cfg.queue, "queue", "", "`directory` to spool batches to that fail every retry; they are sent once exports succeed again, in this run or the next")
+	fs.BoolVar(&cfg.follow, "follow", false, "keep watching the inputs and export spans as they are appended")
+	fs.StringVar(&cfg.checkpoint, "checkpoint", "", "`file` recording how far each input has been exported; resumes from it on restart")
+	fs.DurationVar(&cfg.poll, "poll", defaultPoll, "how often the inputs are checked for new spans in follow mode")
+	fs.StringVar(&cfg.deadLetter, "dead-letter", "", "`file` to append records that cannot be converted to, with the reason and byte offset")
+	fs.BoolVar(&cfg.merge, "merge", false, "read all inputs first and export their spans grouped by trace in start time order; holds every span in memory")
+	fs.BoolVar(&cfg.rotated, "rotated", false, "also read the rotated copies of each input file (file.1, file.2.gz, ...), oldest first; with -checkpoint a copy carries on where the file left off before it was rotated")
+	fs.StringVar(&cfg.dedupIndex, "dedup-index", "", "`file` listing the spans already exported; they are skipped and new ones added, so re-runs are idempotent; the whole index is held in memory, about 100 bytes a span")
+	fs.IntVar(&cfg.dedupWindow, "dedup-window", defaultDedupWindow, "how many of the latest spans of a run are remembered to skip duplicates, about 100 bytes each; 0 turns this off")
+	fs.Func("filter", "only export spans matching this `expression`, e.g. 'service.name == \"service5\" && duration > 50ms'", func(v string) error {
+		f, err := compileFilter(v)
+		cfg.filter = f
+		return err
+	})
+	fs.BoolVar(&cfg.keepTraces, "keep-traces", false, "filter whole traces: keep every span of a trace in which any span matches; holds every span in memory")
+	fs.Func("sample", "tail sampling `policies`: errors, latency=D, probabilistic=R, rate-limit=N; \",\" keeps a trace any of them keeps, \"&\" one all of them keep; holds every span in memory", func(v string) error {
+		p, err := parseSampling(v)
+		cfg.sampler = p
+		return err
+	})
+	cfg.columns = defaultColumns
+	fs.Func("columns", "`columns` of the csv and ndjson outputs: "+strings.Join(defaultColumns, ",")+", attr.<key> and resource.<key>; a leading \"+\" adds to the default columns", func(v string) error {
+		c, err := parseColumns(v)
+		cfg.columns = c
+		return err
+	})
+	fs.Func("rebase", "shift every timestamp by this `duration`, or by whatever makes the latest span end \"now\", keeping relative timing; \"now\" holds every span in memory", func(v string) error {
+		r, err := parseRebase(v)
+		cfg.rebase = r
+		return err
+	})
+	rebaseTraces := fs.Bool("rebase-traces", false, "with -rebase now, move each trace to end now rather than the whole run")
+	var rewriteRules, redactRules, redactKeyFile string
+	fs.StringVar(&rewriteRules, "rewrite-rules", "", "JSON `file` of rules that set, rename, copy or delete attributes and rename spans before export")
+	fs.StringVar(&redactRules, "redact-rules", "", "JSON `file` of rules that drop, mask or hash matching attributes before export")
+	fs.StringVar(&redactKeyFile, "redact-key-file", "", "`file` holding the HMAC key for hash rules (default env "+envRedactKey+")")
+	for name, key := range envVars {
+		f := fs.Lookup(name)
+		f.Usage += " (env " + key + ")"
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, key := range envVars {
+		if v := os.Getenv(key); v != "" && !set[name] {
+			if err := fs.Set(name, v); err != nil {
+				return cfg, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	if cfg.rebase != nil {
+		cfg.rebase.perTrace = *rebaseTraces
+		cfg.transforms = append(cfg.transforms, cfg.rebase.apply)
+	}
+	// Redaction runs last so it also covers values the rewrite rules copied.
+	if rewriteRules != "" {
+		r, err := loadRewriter(rewriteRules)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.transforms = append(cfg.transforms, r.apply)
+	}
+	if redactRules != "" {
+		r, err := loadRedactor(redactRules, redactKeyFile)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.transforms = append(cfg.transforms, r.apply)
+	}
+	if cfg.dedupWindow < 0 {
+		return cfg, fmt.Errorf("dedup window must not be negative, got %d", cfg.dedupWindow)
+	}
+	if cfg.retries < 0 {
+		return cfg, fmt.Errorf("retries must not be negative, got %d", cfg.retries)
+	}
+	if cfg.batchSize < 1 {
+		return cfg, fmt.Errorf("batch size must be at least 1, got %d", cfg.batchSize)
+	}
+	// The index and checkpoint would record spans that a buffered output
+	// has not written yet, and that are lost if writing it fails.
+	if bufferedOutputs[cfg.output] && (cfg.dedupIndex != "" || cfg.checkpoint != "" || cfg.follow) {
+		return cfg, fmt.Errorf("-dedup-index, -checkpoint and -follow cannot be used with -output %s, which writes its file when the run ends", cfg.output)
+	}
+	if (cfg.follow || cfg.checkpoint != "") && (cfg.merge || cfg.keepTraces || cfg.sampler != nil || cfg.rebase.needsTraces()) {
+		return cfg, errors.New("-merge, -keep-traces, -sample and -rebase now cannot be combined with -follow or -checkpoint")
+	}
+
+	cfg.inputs = append(inputs, fs.Args()...)
+	if len(cfg.inputs) == 0 {
+		cfg.inputs = strings.Split(envOr(envInput, defaultInput), ",")
+	}
+	return cfg, nil
+}
+
+func runExport(cfg config) error {
+	dl, err := openDeadLetter(cfg.deadLetter)
+	if err != nil {
+		return err
+	}
+	defer dl.Close()
+	exp, err := newExporter(cfg)
+	if err != nil {
+		return err
+	}
+	dd, err := openDedup(cfg.dedupIndex, cfg.dedupWindow)
+	if err != nil {
+		return err
+	}
+	defer dd.Close()
+	b := newBatcher(exp, cfg.batchSize, cfg.timeout)
+	b.dedup = dd
+	b.retries, b.backoff = cfg.retries, cfg.retryBackoff
+	b.spanRate, b.byteRate = newRateLimiter(cfg.spansPerSec), newRateLimiter(cfg.bytesPerSec)
+	b.progress, b.lastProgress = cfg.progress, time.Now()
+	if b.queue, err = openSpool(cfg.queue); err != nil {
+		return err
+	}
+	// Batches left over from an earlier run go first.
+	b.drain()
+	add := transformed(cfg.transforms, b.add)
+	if cfg.follow || cfg.checkpoint != "" {
+		err = follow(cfg, b, dl, add)
+	} else {
+		err = readSpans(cfg, dl, add)
+	}
+	if err == nil {
+		err = b.flush()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	log.Printf("exported %d spans, skipped %d duplicates", b.exported, dd.dropped)
+	if b.queue != nil && b.queue.pending > 0 {
+		log.Printf("spooled %d spans this run, %d batches waiting in %s", b.spooled, b.queue.pending, b.queue.dir)
+	}
+	return errors.Join(err, exp.Shutdown(ctx), dl.err())
+}
+
+func serviceName(s tracetest.SpanStub) string {
+	if s.Resource != nil {
+		if v, ok := s.Resource.Set().Value(attribute.Key("service.name")); ok {
+			return v.Emit()
+		}
+	}
+	return "unknown"
+}
+
+func runStats(cfg config) error {
+	type count struct{ spans, errors int }
+	services := map[string]*count{}
+	traces := map[trace.TraceID]bool{}
+	dl, err := openDeadLetter(cfg.deadLetter)
+	if err != nil {
+		return err
+	}
+	defer dl.Close()
+	n := 0
+	err = readSpans(cfg, dl, func(sp tracetest.SpanStub) error {
+		n++
+		name := serviceName(sp)
+		c, ok := services[name]
+		if !ok {
+			c = &count{}
+			services[name] = c
+		}
+		c.spans++
+		if sp.Status.Code == codes.Error {
+			c.errors++
+		}
+		traces[sp.SpanContext.TraceID()] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("spans: %d\ntraces: %d\n", n, len(traces))
+	for _, name := range names {
+		fmt.Printf("  %-20s spans=%d errors=%d\n", name, services[name].spans, services[name].errors)
+	}
+	return nil
+}
+
+// runCheck assembles the inputs into traces and prints their integrity
+// problems. It holds every span in memory.
+func runCheck(cfg config) error {
+	dl, err := openDeadLetter(cfg.deadLetter)
+	if err != nil {
+		return err
+	}
+	defer dl.Close()
+	var all tracetest.SpanStubs
+	err = eachSpan(cfg.inputs, cfg.rotated, dl, func(s tracetest.SpanStub) error {
+		all = append(all, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	traces := assemble(all)
+	problems := 0
+	for _, t := range traces {
+		issues := checkTrace(t)
+		if len(issues) == 0 {
+			continue
+		}
+		problems += len(issues)
+		fmt.Printf("trace %s (%d spans)\n", t.id, len(t.spans))
+		for _, is := range issues {
+			fmt.Printf("  %-22s %s %q: %s\n", is.Kind, is.SpanID, is.Span, is.Message)
+		}
+	}
+	fmt.Printf("%d traces, %d spans, %d problems\n", len(traces), len(all), problems)
+	if problems > 0 {
+		return errors.Join(fmt.Errorf("%d integrity problems found", problems), dl.err())
+	}
+	return dl.err()
+}
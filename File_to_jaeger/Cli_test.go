@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConfigRejectsCombinations(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.json")
+	cp := filepath.Join(dir, "cp.json")
+	for _, args := range [][]string{
+		{"-output", "jaeger-json", "-endpoint", out, "-checkpoint", cp},
+		{"-output", "chrome", "-endpoint", out, "-follow"},
+		{"-output", "otlp-json", "-endpoint", out, "-dedup-index", filepath.Join(dir, "index")},
+		{"-checkpoint", cp, "-merge"},
+		{"-follow", "-keep-traces"},
+		{"-checkpoint", cp, "-sample", "errors"},
+		{"-follow", "-rebase", "now"},
+	} {
+		if _, err := parseConfig("export", append(args, filepath.Join(dir, "in.txt"))); err == nil {
+			t.Errorf("%v was accepted", args)
+		}
+	}
+	// Nothing is created for a rejected combination.
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("rejected runs left %d files behind", len(entries))
+	}
+
+	if _, err := parseConfig("export", []string{"-checkpoint", cp, "-rebase", "1h", "in.txt"}); err != nil {
+		t.Errorf("a fixed -rebase with -checkpoint was rejected: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// deadLetter counts the records that could not be converted and, when a
+// file is configured, appends each of them there with the reason and its
+// byte offset so it can be inspected or fixed and replayed later.
+type deadLetter struct {
+	f     *os.File
+	enc   *json.Encoder
+	count int
+
+	// With keep set the rejected records are also kept in memory.
+	keep     bool
+	rejected []deadRecord
+}
+
+type deadRecord struct {
+	Input  string `json:"input"`
+	Offset int64  `json:"offset"`
+	Reason string `json:"reason"`
+	Record string `json:"record"`
+}
+
+func openDeadLetter(path string) (*deadLetter, error) {
+	d := &deadLetter{}
+	if path == "" {
+		return d, nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	d.f = f
+	d.enc = json.NewEncoder(f)
+	return d, nil
+}
+
+func (d *deadLetter) add(input string, r badRecord) error {
+	d.count++
+	log.Printf("%s: rejected record at offset %d: %v", input, r.Start, r.Err)
+	rec := deadRecord{
+		Input:  input,
+		Offset: r.Start,
+		Reason: r.Err.Error(),
+		Record: string(r.Raw),
+	}
+	if d.keep {
+		d.rejected = append(d.rejected, rec)
+	}
+	if d.enc == nil {
+		return nil
+	}
+	return d.enc.Encode(rec)
+}
+
+// err summarises the rejected records, if there were any.
+func (d *deadLetter) err() error {
+	if d.count == 0 {
+		return nil
+	}
+	if d.f != nil {
+		return fmt.Errorf("%d records rejected, see %s", d.count, d.f.Name())
+	}
+	return fmt.Errorf("%d records rejected", d.count)
+}
+
+func (d *deadLetter) Close() error {
+	if d.f == nil {
+		return nil
+	}
+	return d.f.Close()
+}
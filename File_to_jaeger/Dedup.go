@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type spanKey struct {
+	trace trace.TraceID
+	span  trace.SpanID
+}
+
+func keyOf(s tracetest.SpanStub) spanKey {
+	return spanKey{s.SpanContext.TraceID(), s.SpanContext.SpanID()}
+}
+
+// dedup remembers which spans have been seen, keyed on trace and span ID, so
+// overlapping inputs export every span once. Only the most recent window
+// spans of a run are remembered, which keeps memory flat on large inputs
+// and in follow mode. With an index file the spans exported by earlier runs
+// are skipped as well, which makes re-running the converter on the same
+// files safe; every entry of the index is held in memory.
+type dedup struct {
+	indexed map[spanKey]bool
+	dropped int
+
+	// recent holds the keys in ring, which is reused oldest first once it
+	// holds window keys.
+	recent map[spanKey]bool
+	ring   []spanKey
+	next   int
+	window int
+
+	f *os.File
+	w *bufio.Writer
+}
+
+// openDedup loads the index at path, one "traceid spanid" line per exported
+// span, and opens it for appending. An empty path keeps no index. window is
+// how many spans of this run are remembered; 0 turns that off.
+func openDedup(path string, window int) (*dedup, error) {
+	d := &dedup{
+		indexed: map[spanKey]bool{},
+		recent:  map[spanKey]bool{},
+		window:  window,
+	}
+	if path == "" {
+		return d, nil
+	}
+
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		sc := bufio.NewScanner(f)
+		for line := 1; sc.Scan(); line++ {
+			var tid, sid string
+			if _, err := fmt.Sscan(sc.Text(), &tid, &sid); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			var k spanKey
+			if err := errors.Join(decodeID(k.trace[:], tid), decodeID(k.span[:], sid)); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			d.indexed[k] = true
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		return nil, err
+	}
+	d.w = bufio.NewWriter(d.f)
+	return d, nil
+}
+
+// seen reports whether s is in the index or among the recent spans, and
+// remembers it if not.
+func (d *dedup) seen(s tracetest.SpanStub) bool {
+	k := keyOf(s)
+	if d.indexed[k] || d.recent[k] {
+		d.dropped++
+		return true
+	}
+	if d.window == 0 {
+		return false
+	}
+	if len(d.ring) < d.window {
+		d.ring = append(d.ring, k)
+	} else {
+		delete(d.recent, d.ring[d.next])
+		d.ring[d.next] = k
+		d.next = (d.next + 1) % len(d.ring)
+	}
+	d.recent[k] = true
+	return false
+}
+
+// record appends the exported spans to the index file.
+func (d *dedup) record(spans tracetest.SpanStubs) error {
+	if d.w == nil {
+		return nil
+	}
+	for _, s := range spans {
+		fmt.Fprintf(d.w, "%s %s\n", s.SpanContext.TraceID(), s.SpanContext.SpanID())
+	}
+	if err := d.w.Flush(); err != nil {
+		return err
+	}
+	return d.f.Sync()
+}
+
+func (d *dedup) Close() error {
+	if d.f == nil {
+		return nil
+	}
+	return d.f.Close()
+}
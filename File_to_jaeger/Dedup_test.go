@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDedupWindow(t *testing.T) {
+	span := func(sid byte) tracetest.SpanStub {
+		return tracetest.SpanStub{
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{sid}}),
+		}
+	}
+	index := filepath.Join(t.TempDir(), "index")
+
+	d, err := openDedup(index, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.record(tracetest.SpanStubs{span(9)}); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	for _, window := range []int{0, 2} {
+		d, err := openDedup(index, window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 1 is still among the last two spans when repeated, 2 is not.
+		var seen []bool
+		for _, sid := range []byte{1, 1, 2, 3, 4, 2, 9} {
+			seen = append(seen, d.seen(span(sid)))
+		}
+		d.Close()
+		want := []bool{false, window > 0, false, false, false, false, true}
+		for i := range want {
+			if seen[i] != want[i] {
+				t.Errorf("window %d: seen %v, want %v", window, seen, want)
+				break
+			}
+		}
+	}
+}
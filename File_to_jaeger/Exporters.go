@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// defaultEndpoints holds the endpoint each output sends to when -endpoint is
+// not given. Jaeger 1.35 and later accept both OTLP endpoints as well.
+var defaultEndpoints = map[string]string{
+	"jaeger":    "http://simplest-collector:14268/api/traces",
+	"otlp-grpc": "localhost:4317",
+	"otlp-http": "localhost:4318",
+	"zipkin":    "http://localhost:9411/api/v2/spans",
+
+	// File outputs take the file to write as their endpoint.
+	"jaeger-json": "-",
+	"otlp-json":   "-",
+	"chrome":      "-",
+	"csv":         "-",
+	"ndjson":      "-",
+}
+
+// bufferedOutputs hold every span until the run ends, when they write their
+// file, so nothing is delivered while the run is going on.
+var bufferedOutputs = map[string]bool{
+	"jaeger-json": true,
+	"otlp-json":   true,
+	"chrome":      true,
+}
+
+func newExporter(cfg config) (tracesdk.SpanExporter, error) {
+	endpoint := cfg.endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoints[cfg.output]
+	}
+	switch cfg.output {
+	case "jaeger":
+		return jaeger.New(jaeger.WithCollectorEndpoint(
+			jaeger.WithEndpoint(endpoint),
+			jaeger.WithHTTPClient(&http.Client{Timeout: cfg.timeout}),
+		))
+	case "otlp-grpc":
+		return newOTLPGRPC(endpoint, cfg)
+	case "otlp-http":
+		return newOTLPHTTP(endpoint, cfg)
+	case "zipkin":
+		// The Zipkin exporter takes the local service name from the
+		// service.name resource attribute and the remote endpoint from the
+		// peer.service and net.peer.* span attributes.
+		return zipkin.New(endpoint, zipkin.WithClient(&http.Client{Timeout: cfg.timeout}))
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "jaeger-json":
+		return newFileExporter(endpoint, writeJaegerJSON)
+	case "otlp-json":
+		return newFileExporter(endpoint, writeOTLPJSON)
+	case "chrome":
+		return newFileExporter(endpoint, writeChromeTrace)
+	case "csv", "ndjson":
+		// Rows skipped by the checkpoint or index were written by earlier
+		// runs and must be kept.
+		return newRowExporter(endpoint, cfg.output, cfg.columns, cfg.checkpoint != "" || cfg.dedupIndex != "")
+	}
+	return nil, fmt.Errorf("unknown output %q", cfg.output)
+}
+
+// splitEndpoint accepts either host:port or a URL. A URL's scheme decides
+// whether TLS is used and its path, if any, is returned as well.
+func splitEndpoint(endpoint string, insecure bool) (host, path string, plain bool, err error) {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, "", insecure, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", false, err
+	}
+	switch u.Scheme {
+	case "http":
+		plain = true
+	case "https":
+	default:
+		return "", "", false, fmt.Errorf("endpoint %s: unsupported scheme %q", endpoint, u.Scheme)
+	}
+	return u.Host, u.Path, plain, nil
+}
+
+func newOTLPGRPC(endpoint string, cfg config) (tracesdk.SpanExporter, error) {
+	host, _, plain, err := splitEndpoint(endpoint, cfg.insecure)
+	if err != nil {
+		return nil, err
+	}
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(host),
+		otlptracegrpc.WithTimeout(cfg.timeout),
+		// Retrying is left to -retries and -retry-backoff.
+		otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{Enabled: false}),
+	}
+	if plain {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	switch cfg.compression {
+	case "gzip":
+		opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+	case "none":
+	default:
+		return nil, fmt.Errorf("unknown compression %q", cfg.compression)
+	}
+	return otlptracegrpc.New(context.Background(), opts...)
+}
+
+func newOTLPHTTP(endpoint string, cfg config) (tracesdk.SpanExporter, error) {
+	host, path, plain, err := splitEndpoint(endpoint, cfg.insecure)
+	if err != nil {
+		return nil, err
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(host),
+		otlptracehttp.WithTimeout(cfg.timeout),
+		// Retrying is left to -retries and -retry-backoff.
+		otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}),
+	}
+	if path != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(path))
+	}
+	if plain {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	switch cfg.compression {
+	case "gzip":
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	case "none":
+	default:
+		return nil, fmt.Errorf("unknown compression %q", cfg.compression)
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpReceiver records the spans it is sent, by service and name.
+type otlpReceiver struct {
+	coltrace.UnimplementedTraceServiceServer
+
+	mu    sync.Mutex
+	spans []string
+}
+
+func (r *otlpReceiver) Export(ctx context.Context, req *coltrace.ExportTraceServiceRequest) (*coltrace.ExportTraceServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		service := ""
+		for _, kv := range rs.Resource.GetAttributes() {
+			if kv.Key == "service.name" {
+				service = kv.Value.GetStringValue()
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				r.spans = append(r.spans, service+"/"+s.Name)
+			}
+		}
+	}
+	return &coltrace.ExportTraceServiceResponse{}, nil
+}
+
+func (r *otlpReceiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	got := append([]string(nil), r.spans...)
+	sort.Strings(got)
+	return got
+}
+
+// ServeHTTP takes OTLP/HTTP protobuf requests.
+func (r *otlpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/v1/traces" {
+		http.NotFound(w, req)
+		return
+	}
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var msg coltrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, _ := r.Export(req.Context(), &msg)
+	out, _ := proto.Marshal(resp)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(out)
+}
+
+// testSpans returns a parent and a child span of service "test".
+func testSpans(t *testing.T) tracetest.SpanStubs {
+	t.Helper()
+	out := recordSpans(t, func(tr trace.Tracer) {
+		ctx, parent := tr.Start(context.Background(), "parent")
+		_, child := tr.Start(ctx, "child")
+		child.End()
+		parent.End()
+	})
+	spans, bad := decodeAll(t, out)
+	if len(bad) > 0 {
+		t.Fatal(bad[0].Err)
+	}
+	return spans
+}
+
+func TestOTLPExporters(t *testing.T) {
+	want := []string{"test/child", "test/parent"}
+	for _, output := range []string{"otlp-grpc", "otlp-http"} {
+		for _, compression := range []string{"none", "gzip"} {
+			t.Run(output+"/"+compression, func(t *testing.T) {
+				recv := &otlpReceiver{}
+				var endpoint string
+				if output == "otlp-grpc" {
+					lis, err := net.Listen("tcp", "127.0.0.1:0")
+					if err != nil {
+						t.Fatal(err)
+					}
+					srv := grpc.NewServer()
+					coltrace.RegisterTraceServiceServer(srv, recv)
+					go srv.Serve(lis)
+					defer srv.Stop()
+					endpoint = lis.Addr().String()
+				} else {
+					srv := httptest.NewServer(recv)
+					defer srv.Close()
+					endpoint = srv.URL
+				}
+
+				exp, err := newExporter(config{
+					output:      output,
+					endpoint:    endpoint,
+					insecure:    true,
+					timeout:     5 * time.Second,
+					compression: compression,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				ctx := context.Background()
+				if err := exp.ExportSpans(ctx, testSpans(t).Snapshots()); err != nil {
+					t.Fatal(err)
+				}
+				if err := exp.Shutdown(ctx); err != nil {
+					t.Fatal(err)
+				}
+				got := recv.received()
+				if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+					t.Errorf("received %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
-	"context"
+	"bufio"
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
+	"os"
+	"strconv"
 	"strings"
 
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/jaeger"
 	"go.opentelemetry.io/otel/sdk/instrumentation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
@@ -43,11 +46,12 @@ type KeyValue1 struct {
 	Value Val1
 }
 
-// converting string to Code.
+// converting string to Code. The status code is written as a JSON string,
+// so Status1.Code holds the bare name.
 var strToCode = map[string]Code{
-	`"Unset"`: Unset,
-	`"Error"`: Error,
-	`"Ok"`:    Ok,
+	"Unset": Unset,
+	"Error": Error,
+	"Ok":    Ok,
 }
 
 type SpanContext1 struct {
@@ -123,31 +127,12 @@ func attr(kv []KeyValue1) []attribute.KeyValue {
 	//This function is to convert attributes which are in []KeyValue1 to attribute.KeyValue
 	var att []attribute.KeyValue
 	for i := range kv {
-		switch kv[i].Value.Type {
-		case "BOOL":
-			att = append(att, attribute.Bool(kv[i].Key, kv[i].Value.Value.(bool)))
-		case "BOOLSLICE":
-			att = append(att, attribute.BoolSlice(kv[i].Key, kv[i].Value.Value.([]bool)))
-		case "INT64":
-			switch kv[i].Value.Value.(type) {
-			case float64:
-				k1 := int64(kv[i].Value.Value.(float64))
-				att = append(att, attribute.Int64(kv[i].Key, k1))
-			default:
-				att = append(att, attribute.Int64(kv[i].Key, kv[i].Value.Value.(int64)))
-			}
-		case "INT64SLICE":
-			att = append(att, attribute.Int64Slice(kv[i].Key, kv[i].Value.Value.([]int64)))
-		case "FLOAT64":
-			att = append(att, attribute.Float64(kv[i].Key, kv[i].Value.Value.(float64)))
-		case "FLOAT64SLICE":
-			att = append(att, attribute.Float64Slice(kv[i].Key, kv[i].Value.Value.([]float64)))
-		case "STRING":
-			att = append(att, attribute.String(kv[i].Key, kv[i].Value.Value.(string)))
-		case "STRINGSLICE":
-			att = append(att, attribute.StringSlice(kv[i].Key, kv[i].Value.Value.([]string)))
-
+		a, err := attrValue(kv[i])
+		if err != nil {
+			warnf("attribute %q dropped: %v", kv[i].Key, err)
+			continue
 		}
+		att = append(att, a)
 	}
 	return att
 }
@@ -167,25 +152,42 @@ func Eve(ev []Event1) []tracesdk.Event {
 	return k
 }
 
-func convContext(sp SpanContext1) trace.SpanContext {
+func convContext(sp SpanContext1) (trace.SpanContext, error) {
 	//converting SpanContext which is in SpanContext1 format to trace.SpanContext
-	traceID, err := trace.TraceIDFromHex(sp.TraceID)
-	if err != nil {
-		panic(err)
+	var k trace.SpanContextConfig
+	// TraceIDFromHex rejects the all-zero IDs written for the parent of a
+	// root span, so the IDs are decoded directly and IsValid tells roots apart.
+	if err := decodeID(k.TraceID[:], sp.TraceID); err != nil {
+		return trace.SpanContext{}, fmt.Errorf("trace ID: %w", err)
+	}
+	if err := decodeID(k.SpanID[:], sp.SpanID); err != nil {
+		return trace.SpanContext{}, fmt.Errorf("span ID: %w", err)
+	}
+	if sp.TraceFlags != "" {
+		flags, err := strconv.ParseUint(sp.TraceFlags, 16, 8)
+		if err != nil {
+			return trace.SpanContext{}, fmt.Errorf("trace flags %q: %w", sp.TraceFlags, err)
+		}
+		k.TraceFlags = trace.TraceFlags(flags)
 	}
-	spanID, err := trace.SpanIDFromHex(sp.SpanID)
+	ts, err := trace.ParseTraceState(sp.TraceState)
 	if err != nil {
-		panic(err)
+		return trace.SpanContext{}, err
 	}
-	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
-		TraceID: traceID,
-		SpanID:  spanID,
-		Remote:  sp.Remote,
-	})
-	return spanContext
+	k.TraceState = ts
+	k.Remote = sp.Remote
+	return trace.NewSpanContext(k), nil
 }
 
-func Lin(li []Link1) []tracesdk.Link {
+func decodeID(dst []byte, s string) error {
+	if hex.DecodedLen(len(s)) != len(dst) {
+		return fmt.Errorf("%q is not %d hex bytes", s, len(dst))
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+func Lin(li []Link1) ([]tracesdk.Link, error) {
 	//converting Links which is in []Link1 format to []tracesdk.Link
 	var k []tracesdk.Link
 	for i := range li {
@@ -193,19 +195,27 @@ func Lin(li []Link1) []tracesdk.Link {
 		k1 := attr(li[i].Attributes)
 		k2.Attributes = k1
 		k2.DroppedAttributeCount = li[i].DroppedAttributeCount
-		k2.SpanContext = convContext(li[i].SpanContext)
+		sc, err := convContext(li[i].SpanContext)
+		if err != nil {
+			return nil, fmt.Errorf("link %d: %w", i, err)
+		}
+		k2.SpanContext = sc
 		k = append(k, k2)
 	}
-	return k
+	return k, nil
 }
 
-func convStatus(st Status1) tracesdk.Status {
+func convStatus(st Status1) (tracesdk.Status, error) {
 	//Converting Status which is in Status1 format to tracesd.Status
 	var k tracesdk.Status
+	code, ok := strToCode[st.Code]
+	if !ok {
+		return k, fmt.Errorf("unknown status code %q", st.Code)
+	}
 	k.Description = st.Description
-	k.Code = codes.Code(strToCode[st.Code])
+	k.Code = codes.Code(code)
 
-	return k
+	return k, nil
 }
 
 func convLib(sil Library1) instrumentation.Library {
@@ -216,111 +226,179 @@ func convLib(sil Library1) instrumentation.Library {
 	return k
 }
 
-func convert(sp SpanStub) Span {
+func convert(sp SpanStub) (Span, error) {
 	var spa Span
+	var err error
 	spa.Name = sp.Name
-	spa.SpanContext = convContext(sp.SpanContext)
-	// Checking whether there is a parent Trace Id
-	if sp.Parent.TraceID != "00000000000000000000000000000000" {
-		spa.Parent = convContext(sp.Parent)
+	if spa.SpanContext, err = convContext(sp.SpanContext); err != nil {
+		return spa, fmt.Errorf("span context: %w", err)
+	}
+	// The parent of a root span is not valid but still carries the
+	// tracestate the root was started with.
+	if spa.Parent, err = convContext(sp.Parent); err != nil {
+		return spa, fmt.Errorf("parent: %w", err)
+	}
+	if !spa.SpanContext.IsValid() {
+		return spa, fmt.Errorf("span %q has no valid span context", sp.Name)
 	}
 	spa.SpanKind = trace.SpanKind(sp.SpanKind)
 	spa.StartTime = sp.StartTime
 	spa.EndTime = sp.EndTime
 	spa.Attributes = attr(sp.Attributes)
 	spa.Events = Eve(sp.Events)
-	spa.Links = Lin(sp.Links)
-	spa.Status = convStatus(sp.Status)
+	if spa.Links, err = Lin(sp.Links); err != nil {
+		return spa, err
+	}
+	if spa.Status, err = convStatus(sp.Status); err != nil {
+		return spa, err
+	}
 	spa.DroppedAttributes = sp.DroppedAttributes
 	spa.DroppedEvents = sp.DroppedEvents
 	spa.DroppedLinks = sp.DroppedLinks
 	spa.ChildSpanCount = sp.ChildSpanCount
-	k1 := attr(sp.Resource)
-	r := resource.NewSchemaless(k1[0])
-	for i := range k1 {
-		if i != 0 {
-			r, _ = resource.Merge(r, resource.NewSchemaless(k1[i]))
-		}
-	}
-	spa.Resource = r
+	// A span without resource attributes gets an empty resource.
+	spa.Resource = resource.NewSchemaless(attr(sp.Resource)...)
 	spa.InstrumentationLibrary = convLib(sp.InstrumentationLibrary)
-	return spa
+	return spa, nil
 }
 
 func main() {
-	// Let's read the traces file.
-	content, err := ioutil.ReadFile("/Traces/finaltrace1.txt")
-	if err != nil {
-		log.Fatal("Error when opening file: ", err)
-	}
-	//converting traces.txt to string format
-	content1 := string(content)
-	f := strings.NewReader(content1)
-	// creating a decoder
-	dec := json.NewDecoder(f)
-	var dat []SpanStub
-	i := 0
-	for {
+	os.Exit(run(os.Args[1:]))
+}
+
+// badRecord is a record that could not be decoded or converted. Start and
+// End are its byte offsets in the input.
+type badRecord struct {
+	Start, End int64
+	Raw        []byte
+	Err        error
+}
+
+// maxBadRecord caps how much of an undecodable record is kept for the
+// dead-letter file.
+const maxBadRecord = 1 << 20
 
-		var data SpanStub
-		// decoding each span into data variable
-		if err := dec.Decode(&data); err != nil {
+// decodeSpans reads the stdouttrace records in r one at a time and passes
+// each of them, converted to a tracetest.SpanStub, to fn together with the
+// offset in r just past the record. Records that cannot be decoded or
+// converted go to bad instead and decoding carries on with the next record.
+// A record cut short by the end of r is reported as io.ErrUnexpectedEOF.
+func decodeSpans(r io.Reader, fn func(tracetest.SpanStub, int64) error, bad func(badRecord) error) error {
+	var base int64
+	// src is what dec reads from; after a resync that is the reader
+	// skipRecord returned, which may hold bytes already read from r.
+	src := r
+	dec := json.NewDecoder(src)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
 			if err == io.EOF {
-				break
+				return nil
 			}
-			panic(err)
-		}
-		dat = append(dat, data)
-		i++
-	}
-	// Creating array of SpanStubs of length dat
-	s := make(tracetest.SpanStubs, len(dat))
-	for i := range dat {
-		//converting data to span foormat.
-		data1 := convert(dat[i])
-		if dat[i].Parent.TraceID == "00000000000000000000000000000000" {
-			s[i] = tracetest.SpanStub{
-				Name:                   data1.Name,
-				SpanContext:            data1.SpanContext,
-				SpanKind:               data1.SpanKind,
-				StartTime:              data1.StartTime,
-				EndTime:                data1.EndTime,
-				Attributes:             data1.Attributes,
-				Links:                  data1.Links,
-				DroppedAttributes:      data1.DroppedAttributes,
-				DroppedEvents:          data1.DroppedEvents,
-				DroppedLinks:           data1.DroppedLinks,
-				ChildSpanCount:         data1.ChildSpanCount,
-				Resource:               data1.Resource,
-				InstrumentationLibrary: data1.InstrumentationLibrary,
+			var se *json.SyntaxError
+			if !errors.As(err, &se) {
+				return err
 			}
-		} else {
-			s[i] = tracetest.SpanStub{
-				Name:                   data1.Name,
-				SpanContext:            data1.SpanContext,
-				Parent:                 data1.Parent,
-				SpanKind:               data1.SpanKind,
-				StartTime:              data1.StartTime,
-				EndTime:                data1.EndTime,
-				Attributes:             data1.Attributes,
-				Links:                  data1.Links,
-				DroppedAttributes:      data1.DroppedAttributes,
-				DroppedEvents:          data1.DroppedEvents,
-				DroppedLinks:           data1.DroppedLinks,
-				ChildSpanCount:         data1.ChildSpanCount,
-				Resource:               data1.Resource,
-				InstrumentationLibrary: data1.InstrumentationLibrary,
+			// The decoder cannot continue after a syntax error, so skip
+			// to the next line that opens a record and start over there.
+			from := base + dec.InputOffset()
+			rest, lead, n, skipped, serr := skipRecord(io.MultiReader(dec.Buffered(), src))
+			if serr != nil {
+				return serr
 			}
+			if err := bad(badRecord{Start: from + lead, End: from + n, Raw: skipped, Err: err}); err != nil {
+				return err
+			}
+			base = from + n
+			src = rest
+			dec = json.NewDecoder(src)
+			continue
 		}
 
+		end := base + dec.InputOffset()
+		start := end - int64(len(raw))
+		s, err := stub(raw)
+		if err != nil {
+			err = bad(badRecord{Start: start, End: end, Raw: raw, Err: err})
+		} else {
+			err = fn(s, end)
+		}
+		if err != nil {
+			return err
+		}
 	}
+}
 
-	ctx := context.Background()
-	//exporting spans which we converted to jaeger collector.
-	exp, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint("http://simplest-collector:14268/api/traces")))
-	if err == nil {
-		exp.ExportSpans(ctx, s.Snapshots())
+// skipRecord skips the record r starts with, along with any leading
+// whitespace, up to the next line beginning with '{'. It returns a reader
+// positioned there, the length of the leading whitespace, the number of bytes
+// skipped in total and the skipped record.
+func skipRecord(r io.Reader) (rest io.Reader, lead, n int64, skipped []byte, err error) {
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return br, n, n, nil, nil
+		}
+		if err != nil {
+			return nil, n, n, nil, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(c)) {
+			br.UnreadByte()
+			break
+		}
+		n++
 	}
+	lead = n
 
+	for first := true; ; first = false {
+		line, err := br.ReadBytes('\n')
+		if !first && len(line) > 0 && line[0] == '{' {
+			return io.MultiReader(bytes.NewReader(line), br), lead, n, skipped, nil
+		}
+		n += int64(len(line))
+		if len(skipped) < maxBadRecord {
+			skipped = append(skipped, line...)
+		}
+		if err == io.EOF {
+			return br, lead, n, skipped, nil
+		}
+		if err != nil {
+			return nil, lead, n, skipped, err
+		}
+	}
 }
 
+func stub(raw []byte) (tracetest.SpanStub, error) {
+	// Numbers are kept as json.Number so INT64 attributes above 2^53 are
+	// not rounded through float64.
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var sp SpanStub
+	if err := dec.Decode(&sp); err != nil {
+		return tracetest.SpanStub{}, err
+	}
+	//converting data to span foormat.
+	data1, err := convert(sp)
+	if err != nil {
+		return tracetest.SpanStub{}, err
+	}
+	return tracetest.SpanStub{
+		Name:                   data1.Name,
+		SpanContext:            data1.SpanContext,
+		Parent:                 data1.Parent,
+		SpanKind:               data1.SpanKind,
+		StartTime:              data1.StartTime,
+		EndTime:                data1.EndTime,
+		Attributes:             data1.Attributes,
+		Events:                 data1.Events,
+		Links:                  data1.Links,
+		Status:                 data1.Status,
+		DroppedAttributes:      data1.DroppedAttributes,
+		DroppedEvents:          data1.DroppedEvents,
+		DroppedLinks:           data1.DroppedLinks,
+		ChildSpanCount:         data1.ChildSpanCount,
+		Resource:               data1.Resource,
+		InstrumentationLibrary: data1.InstrumentationLibrary,
+	}, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	ts, err := trace.ParseTraceState("vendor=abc,x=y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x52, 0x25, 0x07, 0xcd, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+		SpanID:     trace.SpanID{0x7f, 0x49, 0x77, 1, 2, 3, 4, 5},
+		TraceFlags: trace.FlagsSampled,
+		TraceState: ts,
+		Remote:     true,
+	})
+	linked := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceState: ts,
+	})
+
+	// The spans are kept in memory as they are and written by stdouttrace.
+	want := tracetest.NewInMemoryExporter()
+	var buf bytes.Buffer
+	out, err := stdouttrace.New(stdouttrace.WithWriter(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := tracesdk.NewTracerProvider(
+		tracesdk.WithSyncer(want),
+		tracesdk.WithSyncer(out),
+		tracesdk.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "service1"),
+			attribute.Int64("big", 1<<60),
+		)),
+	)
+	tr := tp.Tracer("lib", trace.WithInstrumentationVersion("1.2.3"), trace.WithSchemaURL("https://example.com/schema"))
+
+	ctx, root := tr.Start(trace.ContextWithRemoteSpanContext(ctx, remote), "root",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("s", "v"),
+			attribute.Bool("b", true),
+			attribute.Int64("i", 1<<55+1),
+			attribute.Float64("f", 1.5),
+			attribute.StringSlice("ss", []string{"a", "b"}),
+			attribute.BoolSlice("bs", []bool{true, false}),
+			attribute.Int64Slice("is", []int64{1, 1 << 55}),
+			attribute.Float64Slice("fs", []float64{0.5, 2}),
+		))
+	_, child := tr.Start(ctx, "child", trace.WithLinks(trace.Link{
+		SpanContext: linked,
+		Attributes:  []attribute.KeyValue{attribute.String("l", "v")},
+	}))
+	child.AddEvent("ev", trace.WithAttributes(attribute.Int("n", 3)))
+	child.SetStatus(codes.Error, "boom")
+	child.End()
+	root.SetStatus(codes.Ok, "")
+	root.End()
+	// Shutting down resets the in-memory exporter.
+	wantSpans := want.GetSpans()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, bad := decodeAll(t, buf.Bytes())
+	if len(bad) > 0 {
+		t.Fatalf("rejected records: %v", bad[0].Err)
+	}
+	got := tracetest.NewInMemoryExporter()
+	if err := got.ExportSpans(context.Background(), decoded.Snapshots()); err != nil {
+		t.Fatal(err)
+	}
+
+	gotSpans := got.GetSpans()
+	if len(gotSpans) != len(wantSpans) {
+		t.Fatalf("got %d spans, want %d", len(gotSpans), len(wantSpans))
+	}
+	for i, w := range wantSpans {
+		g := gotSpans[i]
+		if g.Name != w.Name {
+			t.Errorf("span %d: name %q, want %q", i, g.Name, w.Name)
+		}
+		if !g.SpanContext.Equal(w.SpanContext) {
+			t.Errorf("%s: span context %v, want %v", w.Name, g.SpanContext, w.SpanContext)
+		}
+		if g.SpanContext.TraceState().String() != w.SpanContext.TraceState().String() {
+			t.Errorf("%s: tracestate %q, want %q", w.Name, g.SpanContext.TraceState(), w.SpanContext.TraceState())
+		}
+		if !g.Parent.Equal(w.Parent) {
+			t.Errorf("%s: parent %v, want %v", w.Name, g.Parent, w.Parent)
+		}
+		if g.SpanKind != w.SpanKind {
+			t.Errorf("%s: kind %v, want %v", w.Name, g.SpanKind, w.SpanKind)
+		}
+		if !g.StartTime.Equal(w.StartTime) || !g.EndTime.Equal(w.EndTime) {
+			t.Errorf("%s: times %v-%v, want %v-%v", w.Name, g.StartTime, g.EndTime, w.StartTime, w.EndTime)
+		}
+		if !sameAttrs(g.Attributes, w.Attributes) {
+			t.Errorf("%s: attributes %v, want %v", w.Name, g.Attributes, w.Attributes)
+		}
+		if g.Status != w.Status {
+			t.Errorf("%s: status %v, want %v", w.Name, g.Status, w.Status)
+		}
+		if len(g.Events) != len(w.Events) {
+			t.Fatalf("%s: %d events, want %d", w.Name, len(g.Events), len(w.Events))
+		}
+		for j, we := range w.Events {
+			ge := g.Events[j]
+			if ge.Name != we.Name || !ge.Time.Equal(we.Time) ||
+				!sameAttrs(ge.Attributes, we.Attributes) {
+				t.Errorf("%s: event %v, want %v", w.Name, ge, we)
+			}
+		}
+		if len(g.Links) != len(w.Links) {
+			t.Fatalf("%s: %d links, want %d", w.Name, len(g.Links), len(w.Links))
+		}
+		for j, wl := range w.Links {
+			gl := g.Links[j]
+			if !gl.SpanContext.Equal(wl.SpanContext) ||
+				!sameAttrs(gl.Attributes, wl.Attributes) {
+				t.Errorf("%s: link %v, want %v", w.Name, gl, wl)
+			}
+		}
+		if !g.Resource.Equal(w.Resource) {
+			t.Errorf("%s: resource %v, want %v", w.Name, g.Resource, w.Resource)
+		}
+		if g.InstrumentationLibrary != w.InstrumentationLibrary {
+			t.Errorf("%s: library %v, want %v", w.Name, g.InstrumentationLibrary, w.InstrumentationLibrary)
+		}
+		if g.ChildSpanCount != w.ChildSpanCount {
+			t.Errorf("%s: child span count %d, want %d", w.Name, g.ChildSpanCount, w.ChildSpanCount)
+		}
+	}
+}
+
+// sameAttrs reports whether a and b hold the same attributes in any order.
+func sameAttrs(a, b []attribute.KeyValue) bool {
+	sa, sb := attribute.NewSet(a...), attribute.NewSet(b...)
+	return sa.Equals(&sb)
+}
+
+// recordSpans runs fn with a tracer whose spans stdouttrace writes, one per
+// line, and returns what it wrote.
+func recordSpans(t *testing.T, fn func(trace.Tracer)) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := tracesdk.NewTracerProvider(
+		tracesdk.WithSyncer(exp),
+		tracesdk.WithResource(resource.NewSchemaless(attribute.String("service.name", "test"))),
+	)
+	fn(tp.Tracer("test"))
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decodeAll decodes input and returns the spans and rejected records.
+func decodeAll(t *testing.T, input []byte) (tracetest.SpanStubs, []badRecord) {
+	t.Helper()
+	var spans tracetest.SpanStubs
+	var bad []badRecord
+	err := decodeSpans(bytes.NewReader(input), func(s tracetest.SpanStub, _ int64) error {
+		spans = append(spans, s)
+		return nil
+	}, func(r badRecord) error {
+		bad = append(bad, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spans, bad
+}
+
+func TestDecodeSpansResyncsAfterNearbyBadRecords(t *testing.T) {
+	out := recordSpans(t, func(tr trace.Tracer) {
+		for i := 0; i < 5; i++ {
+			_, s := tr.Start(context.Background(), fmt.Sprintf("span%d", i))
+			s.End()
+		}
+	})
+	lines := bytes.SplitAfter(out, []byte("\n"))
+	bad1 := []byte("{\"Name\": broken\n")
+	bad2 := []byte("{\"Name\": \"x\", oops\n")
+
+	var input []byte
+	input = append(input, bad1...)
+	input = append(input, lines[0]...)
+	offset2 := len(input)
+	input = append(input, bad2...)
+	for _, l := range lines[1:] {
+		input = append(input, l...)
+	}
+
+	spans, bad := decodeAll(t, input)
+	if len(spans) != 5 {
+		t.Fatalf("decoded %d spans, want 5", len(spans))
+	}
+	for i, s := range spans {
+		if want := fmt.Sprintf("span%d", i); s.Name != want {
+			t.Errorf("span %d is %q, want %q", i, s.Name, want)
+		}
+	}
+	if len(bad) != 2 {
+		t.Fatalf("rejected %d records, want 2", len(bad))
+	}
+	if !bytes.Equal(bad[0].Raw, bad1) || bad[0].Start != 0 {
+		t.Errorf("first rejected record %q at %d, want %q at 0", bad[0].Raw, bad[0].Start, bad1)
+	}
+	if !bytes.Equal(bad[1].Raw, bad2) || bad[1].Start != int64(offset2) {
+		t.Errorf("second rejected record %q at %d, want %q at %d", bad[1].Raw, bad[1].Start, bad2, offset2)
+	}
+}
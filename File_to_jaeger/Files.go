@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fileExporter collects every exported span and writes them all to path,
+// or standard output for "-", when shut down. It is used by the file formats
+// that group spans by trace or resource. The file is replaced in one step,
+// so a run that fails leaves the previous one in place.
+type fileExporter struct {
+	path  string
+	write func(io.Writer, tracetest.SpanStubs) error
+
+	mu    sync.Mutex
+	done  bool
+	spans tracetest.SpanStubs
+}
+
+// newFileExporter checks that a file can be created next to path right
+// away, so a path that cannot be written fails the run before any input is
+// read.
+func newFileExporter(path string, write func(io.Writer, tracetest.SpanStubs) error) (*fileExporter, error) {
+	if path != "-" {
+		f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+	return &fileExporter{path: path, write: write}, nil
+}
+
+func (e *fileExporter) ExportSpans(ctx context.Context, spans []tracesdk.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, tracetest.SpanStubsFromReadOnlySpans(spans)...)
+	return nil
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done {
+		return nil
+	}
+	spans := e.spans
+	e.done, e.spans = true, nil
+	if e.path == "-" {
+		return e.write(os.Stdout, spans)
+	}
+	return writeFileAtomic(e.path, func(w io.Writer) error {
+		return e.write(w, spans)
+	})
+}
+
+// writeFileAtomic writes the file at path through a temporary file in the
+// same directory that is renamed into place, so a crash never leaves a half
+// written file behind.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
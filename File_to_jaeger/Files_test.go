@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFileExporterKeepsOldFileOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.json")
+	if err := os.WriteFile(out, []byte("previous run"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newFileExporter(filepath.Join(dir, "missing", "out.json"), writeJaegerJSON); err == nil {
+		t.Error("no error for an output in a missing directory")
+	}
+
+	failing := func(w io.Writer, s tracetest.SpanStubs) error {
+		io.WriteString(w, "half")
+		return errors.New("disk full")
+	}
+	e, err := newFileExporter(out, failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Shutdown(context.Background()); err == nil {
+		t.Fatal("Shutdown did not report the failed write")
+	}
+	check := func(want string) {
+		t.Helper()
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("output is %q, want %q", b, want)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("%d files left in the directory, want only the output", len(entries))
+		}
+	}
+	check("previous run")
+
+	e, err = newFileExporter(out, func(w io.Writer, s tracetest.SpanStubs) error {
+		_, err := io.WriteString(w, "this run")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	check("this run")
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// A filter expression selects spans by their decoded fields, for example
+//
+//	service.name == "service5" && duration > 50ms
+//	status == Error || name =~ "^GET "
+//	start >= "2022-06-01T10:00:00Z" && trace_id in ("4bf9...", "00f0...")
+//
+// The left side of a comparison is a field: name, kind, status,
+// status.description, duration, start, end, trace_id, span_id, parent_id,
+// service, attr.<key>, resource.<key>, or any other key, which is looked up
+// in the span attributes and then in the resource. The right side is a
+// string, number, duration, bare word or, for "in", a parenthesised list.
+// Comparisons combine with &&, || and !, and group with parentheses.
+type filterExpr interface {
+	eval(s tracetest.SpanStub) bool
+}
+
+type andExpr struct{ l, r filterExpr }
+
+func (e andExpr) eval(s tracetest.SpanStub) bool { return e.l.eval(s) && e.r.eval(s) }
+
+type orExpr struct{ l, r filterExpr }
+
+func (e orExpr) eval(s tracetest.SpanStub) bool { return e.l.eval(s) || e.r.eval(s) }
+
+type notExpr struct{ e filterExpr }
+
+func (e notExpr) eval(s tracetest.SpanStub) bool { return !e.e.eval(s) }
+
+// literal is the right side of a comparison, parsed every way it can be.
+type literal struct {
+	text  string
+	num   float64
+	isNum bool
+	dur   time.Duration
+	isDur bool
+	t     time.Time
+	isT   bool
+}
+
+func newLiteral(text string) literal {
+	l := literal{text: text}
+	if n, err := strconv.ParseFloat(text, 64); err == nil {
+		l.num, l.isNum = n, true
+	}
+	if d, err := time.ParseDuration(text); err == nil {
+		l.dur, l.isDur = d, true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, text); err == nil {
+		l.t, l.isT = t, true
+	}
+	return l
+}
+
+type cmpExpr struct {
+	field string
+	op    string
+	lits  []literal
+	re    *regexp.Regexp
+}
+
+func (e cmpExpr) eval(s tracetest.SpanStub) bool {
+	v, ok := fieldValue(s, e.field)
+	if !ok {
+		// A missing field is unequal to everything.
+		return e.op == "!=" || e.op == "!~"
+	}
+	switch e.op {
+	case "=~":
+		return e.re.MatchString(v.str)
+	case "!~":
+		return !e.re.MatchString(v.str)
+	case "in":
+		for _, l := range e.lits {
+			if c, ok := v.compare(l); ok && c == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	c, ok := v.compare(e.lits[0])
+	if !ok {
+		return e.op == "!="
+	}
+	switch e.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+type valueKind int
+
+const (
+	strValue valueKind = iota
+	numValue
+	durValue
+	timeValue
+)
+
+// filterValue is a span field ready for comparison. str is always set.
+type filterValue struct {
+	kind valueKind
+	str  string
+	num  float64
+	dur  time.Duration
+	t    time.Time
+	// fold makes string comparisons case insensitive.
+	fold bool
+}
+
+func (v filterValue) compare(l literal) (int, bool) {
+	switch v.kind {
+	case numValue:
+		if l.isNum {
+			return cmp3(v.num < l.num, v.num > l.num), true
+		}
+	case durValue:
+		if l.isDur {
+			return cmp3(v.dur < l.dur, v.dur > l.dur), true
+		}
+	case timeValue:
+		if l.isT {
+			return cmp3(v.t.Before(l.t), v.t.After(l.t)), true
+		}
+	}
+	if v.kind != strValue {
+		return 0, false
+	}
+	a, b := v.str, l.text
+	if v.fold {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+	return strings.Compare(a, b), true
+}
+
+func cmp3(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func fieldValue(s tracetest.SpanStub, field string) (filterValue, bool) {
+	switch field {
+	case "name":
+		return filterValue{str: s.Name}, true
+	case "kind":
+		return filterValue{str: s.SpanKind.String(), fold: true}, true
+	case "status":
+		return filterValue{str: s.Status.Code.String(), fold: true}, true
+	case "status.description":
+		return filterValue{str: s.Status.Description}, true
+	case "duration":
+		d := s.EndTime.Sub(s.StartTime)
+		return filterValue{kind: durValue, str: d.String(), dur: d}, true
+	case "start":
+		return filterValue{kind: timeValue, str: s.StartTime.Format(time.RFC3339Nano), t: s.StartTime}, true
+	case "end":
+		return filterValue{kind: timeValue, str: s.EndTime.Format(time.RFC3339Nano), t: s.EndTime}, true
+	case "trace_id":
+		return filterValue{str: s.SpanContext.TraceID().String(), fold: true}, true
+	case "span_id":
+		return filterValue{str: s.SpanContext.SpanID().String(), fold: true}, true
+	case "parent_id":
+		if !s.Parent.IsValid() {
+			return filterValue{}, false
+		}
+		return filterValue{str: s.Parent.SpanID().String(), fold: true}, true
+	case "service":
+		return filterValue{str: serviceName(s)}, true
+	}
+
+	if key, ok := strings.CutPrefix(field, "attr."); ok {
+		return attrFilterValue(s.Attributes, key)
+	}
+	if key, ok := strings.CutPrefix(field, "resource."); ok {
+		return resourceFilterValue(s, key)
+	}
+	if v, ok := attrFilterValue(s.Attributes, field); ok {
+		return v, true
+	}
+	return resourceFilterValue(s, field)
+}
+
+func attrFilterValue(kvs []attribute.KeyValue, key string) (filterValue, bool) {
+	for _, kv := range kvs {
+		if string(kv.Key) == key {
+			return valueOf(kv.Value), true
+		}
+	}
+	return filterValue{}, false
+}
+
+func resourceFilterValue(s tracetest.SpanStub, key string) (filterValue, bool) {
+	if s.Resource == nil {
+		return filterValue{}, false
+	}
+	v, ok := s.Resource.Set().Value(attribute.Key(key))
+	if !ok {
+		return filterValue{}, false
+	}
+	return valueOf(v), true
+}
+
+func valueOf(v attribute.Value) filterValue {
+	switch v.Type() {
+	case attribute.INT64:
+		return filterValue{kind: numValue, str: v.Emit(), num: float64(v.AsInt64())}
+	case attribute.FLOAT64:
+		return filterValue{kind: numValue, str: v.Emit(), num: v.AsFloat64()}
+	}
+	return filterValue{str: v.Emit()}
+}
+
+// compileFilter parses a filter expression. An empty expression yields a
+// nil filterExpr, which means no filtering.
+func compileFilter(src string) (filterExpr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	toks, err := lexFilter(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	e, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("filter: unexpected %q", t.text)
+	}
+	return e, nil
+}
+
+// filtered passes to fn only the spans that match f.
+func filtered(f filterExpr, fn func(tracetest.SpanStub) error) func(tracetest.SpanStub) error {
+	return func(s tracetest.SpanStub) error {
+		if !f.eval(s) {
+			return nil
+		}
+		return fn(s)
+	}
+}
+
+// anyMatch reports whether f matches at least one of spans.
+func anyMatch(f filterExpr, spans tracetest.SpanStubs) bool {
+	for _, s := range spans {
+		if f.eval(s) {
+			return true
+		}
+	}
+	return false
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+}
+
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", ","}
+
+func lexFilter(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && rune(src[j]) != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("filter: unterminated string at offset %d", i)
+			}
+			text := src[i+1 : j]
+			if c == '"' {
+				var err error
+				if text, err = strconv.Unquote(src[i : j+1]); err != nil {
+					return nil, fmt.Errorf("filter: string at offset %d: %w", i, err)
+				}
+			}
+			toks = append(toks, token{tokString, text})
+			i = j + 1
+			continue
+		}
+
+		matched := false
+		for _, op := range filterOps {
+			if strings.HasPrefix(src[i:], op) {
+				toks = append(toks, token{tokOp, op})
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		j := i
+		for j < len(src) && isWordByte(src[j]) {
+			j++
+		}
+		if j == i {
+			return nil, fmt.Errorf("filter: unexpected %q at offset %d", src[i], i)
+		}
+		toks = append(toks, token{tokIdent, src[i:j]})
+		i = j
+	}
+	return toks, nil
+}
+
+// isWordByte reports whether b can be part of a field name, bare word,
+// number or duration such as http.status_code, user-id, 1.5 or 50ms.
+func isWordByte(b byte) bool {
+	return b == '.' || b == '_' || b == '-' || b == '/' || b == ':' || b == '+' ||
+		b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+type filterParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *filterParser) peek() token {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return token{kind: tokEOF}
+}
+
+func (p *filterParser) next() token {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (filterExpr, error) {
+	l, err := p.and()
+	for err == nil && p.accept("||") {
+		var r filterExpr
+		if r, err = p.and(); err == nil {
+			l = orExpr{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *filterParser) and() (filterExpr, error) {
+	l, err := p.unary()
+	for err == nil && p.accept("&&") {
+		var r filterExpr
+		if r, err = p.unary(); err == nil {
+			l = andExpr{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *filterParser) unary() (filterExpr, error) {
+	if p.accept("!") {
+		e, err := p.unary()
+		return notExpr{e}, err
+	}
+	if p.accept("(") {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return e, nil
+	}
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (filterExpr, error) {
+	f := p.next()
+	if f.kind != tokIdent {
+		return nil, fmt.Errorf("expected a field, got %q", f.text)
+	}
+	op := p.next()
+	if op.kind == tokIdent && op.text == "in" {
+		lits, err := p.list()
+		return cmpExpr{field: f.text, op: "in", lits: lits}, err
+	}
+	switch op.text {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+	default:
+		return nil, fmt.Errorf("expected a comparison after %s, got %q", f.text, op.text)
+	}
+	v := p.next()
+	if v.kind != tokIdent && v.kind != tokString {
+		return nil, fmt.Errorf("expected a value after %s %s, got %q", f.text, op.text, v.text)
+	}
+	e := cmpExpr{field: f.text, op: op.text, lits: []literal{newLiteral(v.text)}}
+	if op.text == "=~" || op.text == "!~" {
+		re, err := regexp.Compile(v.text)
+		if err != nil {
+			return nil, err
+		}
+		e.re = re
+	}
+	return e, nil
+}
+
+func (p *filterParser) list() ([]literal, error) {
+	if !p.accept("(") {
+		return nil, fmt.Errorf("expected ( after in")
+	}
+	var lits []literal
+	for {
+		v := p.next()
+		if v.kind != tokIdent && v.kind != tokString {
+			return nil, fmt.Errorf("expected a value in list, got %q", v.text)
+		}
+		lits = append(lits, newLiteral(v.text))
+		if p.accept(")") {
+			return lits, nil
+		}
+		if !p.accept(",") {
+			return nil, fmt.Errorf("expected , or ) in list")
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFilter(t *testing.T) {
+	mustID := func(s string) trace.TraceID {
+		id, err := trace.TraceIDFromHex(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	start := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	slow := tracetest.SpanStub{
+		Name: "GET /users",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: mustID("4bf92f3577b34da6a3ce929d0e0e4736"), SpanID: trace.SpanID{1},
+		}),
+		Parent: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: mustID("4bf92f3577b34da6a3ce929d0e0e4736"), SpanID: trace.SpanID{2},
+		}),
+		SpanKind:   trace.SpanKindServer,
+		StartTime:  start,
+		EndTime:    start.Add(80 * time.Millisecond),
+		Status:     tracesdk.Status{Code: codes.Error},
+		Attributes: []attribute.KeyValue{attribute.Int("http.status_code", 500), attribute.String("user.id", "u1")},
+		Resource:   resource.NewSchemaless(attribute.String("service.name", "service5"), attribute.String("env", "prod")),
+	}
+	fast := tracetest.SpanStub{
+		Name: "POST /x",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: mustID("00f067aa0ba902b700f067aa0ba902b7"), SpanID: trace.SpanID{3},
+		}),
+		StartTime: start.Add(-time.Hour),
+		EndTime:   start.Add(-time.Hour + 10*time.Millisecond),
+		Resource:  resource.NewSchemaless(attribute.String("service.name", "service1")),
+	}
+
+	for _, tc := range []struct {
+		expr       string
+		slow, fast bool
+	}{
+		{`service.name == "service5" && duration > 50ms`, true, false},
+		{`status == Error`, true, false},
+		{`status == error`, true, false},
+		{`kind == server`, true, false},
+		{`name =~ "^GET "`, true, false},
+		{`start >= "2022-06-01T09:30:00Z" && start < "2022-06-01T11:00:00Z"`, true, false},
+		{`end <= "2022-06-01T09:00:01Z"`, false, true},
+		{`trace_id in ("4BF92F3577B34DA6A3CE929D0E0E4736", "ffff")`, true, false},
+		{`span_id in (0300000000000000)`, false, true},
+		{`http.status_code >= 500`, true, false},
+		{`attr.http.status_code == 500`, true, false},
+		{`resource.env == prod`, true, false},
+		{`env == 'prod'`, true, false},
+		{`service == service1`, false, true},
+
+		// ! binds tighter than &&, which binds tighter than ||.
+		{`!service.name == "service5"`, false, true},
+		{`!status == Error && duration < 50ms`, false, true},
+		{`status == Error || service == "service5" && duration < 1ms`, true, false},
+		{`!(status == Error || duration < 1ms)`, false, true},
+		{`(status == Error || duration < 1ms) && kind == internal`, false, false},
+
+		// A missing field is unequal to everything.
+		{`http.status_code != 500`, false, true},
+		{`user.id !~ "^u"`, false, true},
+		{`user.id == u1`, true, false},
+		{`user.id =~ "."`, true, false},
+		{`parent_id != 0200000000000000`, false, true},
+		{`parent_id == 0200000000000000`, true, false},
+		// A value of the wrong type is unequal too.
+		{`duration != 5`, true, true},
+		{`duration == 5`, false, false},
+	} {
+		f, err := compileFilter(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if got := f.eval(slow); got != tc.slow {
+			t.Errorf("%s: slow span matched %v, want %v", tc.expr, got, tc.slow)
+		}
+		if got := f.eval(fast); got != tc.fast {
+			t.Errorf("%s: fast span matched %v, want %v", tc.expr, got, tc.fast)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	if f, err := compileFilter("  "); f != nil || err != nil {
+		t.Errorf("empty filter gave %v, %v, want no filter", f, err)
+	}
+	for _, expr := range []string{
+		`name == "unterminated`,
+		`name == "bad \q escape"`,
+		`name # 1`,
+		`name == a &&`,
+		`(name == a`,
+		`name == a)`,
+		`name`,
+		`name ~~ a`,
+		`name =~ "("`,
+		`"name" == a`,
+		`name in a`,
+		`name in (a b)`,
+		`name in ()`,
+	} {
+		if _, err := compileFilter(expr); err == nil {
+			t.Errorf("%s compiled without error", expr)
+		}
+	}
+}
+
+func TestFilterKeepTraces(t *testing.T) {
+	in := filepath.Join(t.TempDir(), "in.txt")
+	out := recordSpans(t, func(tr trace.Tracer) {
+		ctx, parent := tr.Start(context.Background(), "parent")
+		_, child := tr.Start(ctx, "match")
+		child.End()
+		parent.End()
+		_, other := tr.Start(context.Background(), "other")
+		other.End()
+	})
+	if err := os.WriteFile(in, out, 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := compileFilter(`name == match`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keep := range []bool{false, true} {
+		dl, err := openDeadLetter("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		cfg := config{inputs: []string{in}, filter: f, keepTraces: keep}
+		err = readSpans(cfg, dl, func(s tracetest.SpanStub) error {
+			names = append(names, s.Name)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 1
+		if keep {
+			// The whole trace of the matching span, without the other one.
+			want = 2
+		}
+		if len(names) != want {
+			t.Errorf("keep-traces %v: got spans %v, want %d", keep, names, want)
+		}
+		for _, n := range names {
+			if n == "other" {
+				t.Errorf("keep-traces %v: got span of an unmatched trace", keep)
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// checkpoint records, per input file, the byte offset just past the last
+// record that was exported. Files are told apart by their first bytes
+// rather than their name, so a file that log rotation renamed, and maybe
+// compressed, keeps its offset and a new file under the old name starts
+// from the beginning.
+type checkpoint struct {
+	path  string
+	marks []*fileMark
+	// read holds the inputs read in this run.
+	read map[string]bool
+}
+
+// fileMark is the checkpoint of one file. The file is the one whose first
+// HeadSize bytes hash to HeadSHA256; Path is where it was last read.
+type fileMark struct {
+	Path       string `json:"path"`
+	HeadSize   int    `json:"head_size"`
+	HeadSHA256 string `json:"head_sha256"`
+	Offset     int64  `json:"offset"`
+	// Size and ModTime are those of a compressed file that was read to its
+	// end. Such a file is not opened again while they stay the same.
+	Size    int64 `json:"size,omitempty"`
+	ModTime int64 `json:"mtime,omitempty"`
+
+	// legacy marks come from checkpoints keyed by name only.
+	legacy bool
+	// used marks were matched in this run, claimed ones in this poll.
+	used, claimed bool
+}
+
+// headSize is how much of a file identifies it. stdouttrace starts every
+// record with its span name and IDs, so this always takes in random IDs.
+const headSize = 1024
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{path: path, read: map[string]bool{}}
+	if path == "" {
+		return cp, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &cp.marks); err == nil {
+		return cp, nil
+	}
+	// Older checkpoints map each name to its offset.
+	var offsets map[string]int64
+	if err := json.Unmarshal(b, &offsets); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	for name, off := range offsets {
+		cp.marks = append(cp.marks, &fileMark{Path: name, Offset: off, legacy: true})
+	}
+	return cp, nil
+}
+
+// mark returns the checkpoint of the file at path, which starts with head.
+// A file is matched by the longest stored head that head begins with,
+// preferring one last read under the same name; a file seen for the first
+// time gets a new mark at offset 0.
+func (cp *checkpoint) mark(path string, head []byte) *fileMark {
+	cp.read[path] = true
+	var best *fileMark
+	for _, m := range cp.marks {
+		switch {
+		case m.legacy:
+			if m.Path != path {
+				continue
+			}
+		case m.claimed, m.HeadSize > len(head), m.HeadSHA256 != headHash(head[:m.HeadSize]):
+			continue
+		}
+		if best == nil || m.HeadSize > best.HeadSize || m.HeadSize == best.HeadSize && m.Path == path {
+			best = m
+		}
+	}
+	if best == nil {
+		best = &fileMark{}
+		cp.marks = append(cp.marks, best)
+	}
+	// The head grows with the file until it reaches headSize.
+	best.Path, best.HeadSize, best.HeadSHA256 = path, len(head), headHash(head)
+	best.legacy, best.used, best.claimed = false, true, true
+	best.Size, best.ModTime = 0, 0
+	return best
+}
+
+// unchanged reports whether the file at path is a compressed file that was
+// read to its end and has not changed since, keeping its mark if so.
+func (cp *checkpoint) unchanged(path string, st os.FileInfo) bool {
+	for _, m := range cp.marks {
+		if m.Path == path && !m.claimed && m.ModTime != 0 && m.Size == st.Size() && m.ModTime == st.ModTime().UnixNano() {
+			cp.read[path] = true
+			m.used, m.claimed = true, true
+			return true
+		}
+	}
+	return false
+}
+
+// newPoll lets every mark be matched again.
+func (cp *checkpoint) newPoll() {
+	for _, m := range cp.marks {
+		m.claimed = false
+	}
+}
+
+func headHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileHead returns the first headSize bytes of the file at path, after
+// decompression, or all of it if it is shorter.
+func fileHead(path string) ([]byte, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, headSize)
+	n, err := io.ReadFull(f, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// save writes the marks of the files read in this run and those of other
+// files that still exist, dropping the ones that can no longer be read.
+func (cp *checkpoint) save() error {
+	if cp.path == "" {
+		return nil
+	}
+	keep := []*fileMark{}
+	for _, m := range cp.marks {
+		if m.used {
+			keep = append(keep, m)
+			continue
+		}
+		if cp.read[m.Path] {
+			// Another file took its name.
+			continue
+		}
+		if _, err := os.Stat(m.Path); err == nil {
+			keep = append(keep, m)
+		}
+	}
+	b, err := json.MarshalIndent(keep, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(cp.path, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// readFrom decodes the records of the file at path starting at offset and
+// passes each span to fn, and each record that cannot be converted to bad,
+// with offsets from the start of the file. A record that is still being
+// written at the end of the file is left for the next call. complete is set
+// for a compressed file that was read to its end.
+func readFrom(path string, offset int64, fn func(tracetest.SpanStub, int64) error, bad func(badRecord) error) (complete bool, err error) {
+	f, err := openInput(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if !f.compressed {
+		st, err := f.file.Stat()
+		if err != nil {
+			return false, err
+		}
+		if st.Size() < offset {
+			log.Printf("%s was truncated, reading it from the start", path)
+			offset = 0
+		}
+	}
+	if err := f.skip(offset); err != nil {
+		return false, err
+	}
+
+	err = decodeSpans(f, func(s tracetest.SpanStub, end int64) error {
+		return fn(s, offset+end)
+	}, func(r badRecord) error {
+		r.Start += offset
+		r.End += offset
+		return bad(r)
+	})
+	if err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	return f.compressed && err == nil, err
+}
+
+// errStopped ends reading an input when follow is interrupted.
+var errStopped = errors.New("stopped")
+
+// follow passes the spans of the inputs to add from their checkpointed
+// offsets, which for a compressed file count decompressed bytes, and flushes
+// b. With -follow it then keeps polling them for appended spans until
+// interrupted, which stops it at the next record; the checkpoint is saved
+// after every successful export.
+func follow(cfg config, b *batcher, dl *deadLetter, add func(tracetest.SpanStub) error) error {
+	for _, in := range cfg.inputs {
+		if in == "-" {
+			return errors.New("standard input cannot be followed or checkpointed")
+		}
+	}
+	cp, err := loadCheckpoint(cfg.checkpoint)
+	if err != nil {
+		return err
+	}
+	b.flushed = cp.save
+	if cfg.filter != nil {
+		add = filtered(cfg.filter, add)
+	}
+
+	// Without -follow an interrupt ends the run at once; everything up to
+	// the last export is already in the checkpoint.
+	ctx := context.Background()
+	if cfg.follow {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+	for {
+		// Globs are expanded again on every poll to pick up new files.
+		files, err := expandInputs(cfg.inputs, cfg.rotated)
+		if err != nil {
+			return err
+		}
+		cp.newPoll()
+		for _, in := range files {
+			st, err := os.Stat(in)
+			if err == nil && cp.unchanged(in, st) {
+				// Compressed copies do not change, and decompressing
+				// them to their end on every poll would be wasted.
+				continue
+			}
+			var head []byte
+			if err == nil {
+				head, err = fileHead(in)
+			}
+			if err == nil && len(head) == 0 {
+				// An empty file cannot be told apart from others yet, and
+				// has nothing to read.
+				continue
+			}
+			if err == nil {
+				m := cp.mark(in, head)
+				var complete bool
+				complete, err = readFrom(in, m.Offset, func(s tracetest.SpanStub, off int64) error {
+					if ctx.Err() != nil {
+						return errStopped
+					}
+					m.Offset = off
+					return add(s)
+				}, func(r badRecord) error {
+					if ctx.Err() != nil {
+						return errStopped
+					}
+					// Rejected records are not read again on the next poll.
+					m.Offset = r.End
+					return dl.add(in, r)
+				})
+				if complete {
+					m.Size, m.ModTime = st.Size(), st.ModTime().UnixNano()
+				}
+			}
+			if errors.Is(err, errStopped) {
+				// The spans read so far are exported and checkpointed.
+				return b.flush()
+			}
+			if cfg.follow && errors.Is(err, fs.ErrNotExist) {
+				// The service has not written anything yet.
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", in, err)
+			}
+		}
+		if err := b.flush(); err != nil {
+			return err
+		}
+		if !cfg.follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cfg.poll):
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanLines returns n stdouttrace records, one per line.
+func spanLines(t *testing.T, n int) []byte {
+	t.Helper()
+	return recordSpans(t, func(tr trace.Tracer) {
+		for i := 0; i < n; i++ {
+			_, s := tr.Start(context.Background(), fmt.Sprintf("span%d", i))
+			s.End()
+		}
+	})
+}
+
+// exportOnce runs the checkpointed export of cfg once and returns the spans
+// it exported and the number of records it rejected.
+func exportOnce(t *testing.T, cfg config) (tracetest.SpanStubs, int) {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	b := newBatcher(exp, 10, time.Second)
+	dl, err := openDeadLetter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := follow(cfg, b, dl, b.add); err != nil {
+		t.Fatal(err)
+	}
+	return exp.GetSpans(), dl.count
+}
+
+func appendFile(t *testing.T, path string, b []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckpointSurvivesRotation(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.txt")
+	cfg := config{inputs: []string{live}, checkpoint: filepath.Join(dir, "checkpoint.json")}
+
+	appendFile(t, live, spanLines(t, 1))
+	if spans, bad := exportOnce(t, cfg); len(spans) != 1 || bad != 0 {
+		t.Fatalf("first run exported %d spans and rejected %d records, want 1 and 0", len(spans), bad)
+	}
+
+	// The rotated file is not read, and the new file under the old name
+	// is read from its start.
+	if err := os.Rename(live, live+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, live, spanLines(t, 3))
+	if spans, bad := exportOnce(t, cfg); len(spans) != 3 || bad != 0 {
+		t.Fatalf("after rotation exported %d spans and rejected %d records, want 3 and 0", len(spans), bad)
+	}
+	if spans, _ := exportOnce(t, cfg); len(spans) != 0 {
+		t.Fatalf("third run exported %d spans, want 0", len(spans))
+	}
+}
+
+func TestCheckpointReadsLegacyOffsets(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.txt")
+	first := spanLines(t, 1)
+	appendFile(t, live, first)
+	appendFile(t, live, spanLines(t, 2))
+	cp := filepath.Join(dir, "checkpoint.json")
+	legacy := fmt.Sprintf("{%q: %d}", live, len(first))
+	if err := os.WriteFile(cp, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{inputs: []string{live}, checkpoint: cp}
+	if spans, _ := exportOnce(t, cfg); len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	b, err := os.ReadFile(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte("head_sha256")) {
+		t.Errorf("checkpoint not rewritten with file identities: %s", b)
+	}
+}
+
+func TestCheckpointFollowsRotatedCopies(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("gzip=%v", compress), func(t *testing.T) {
+			dir := t.TempDir()
+			live := filepath.Join(dir, "live.txt")
+			cfg := config{inputs: []string{live}, rotated: true, checkpoint: filepath.Join(dir, "checkpoint.json")}
+
+			appendFile(t, live, spanLines(t, 2))
+			if spans, _ := exportOnce(t, cfg); len(spans) != 2 {
+				t.Fatalf("first run exported %d spans, want 2", len(spans))
+			}
+
+			// A span written just before rotation is only in the rotated
+			// copy, which carries on from the offset of the live file.
+			appendFile(t, live, spanLines(t, 1))
+			rotated := live + ".1"
+			if compress {
+				b, err := os.ReadFile(live)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rotated += ".gz"
+				writeGzip(t, rotated, b)
+				os.Remove(live)
+			} else if err := os.Rename(live, rotated); err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, live, spanLines(t, 1))
+
+			spans, bad := exportOnce(t, cfg)
+			if len(spans) != 2 || bad != 0 {
+				t.Fatalf("after rotation exported %d spans and rejected %d records, want 2 and 0", len(spans), bad)
+			}
+		})
+	}
+}
+
+func TestCheckpointSkipsReadArchives(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.txt")
+	archive := live + ".1.gz"
+	cfg := config{inputs: []string{live}, rotated: true, checkpoint: filepath.Join(dir, "checkpoint.json")}
+	writeGzip(t, archive, spanLines(t, 2))
+	appendFile(t, live, spanLines(t, 1))
+	if spans, _ := exportOnce(t, cfg); len(spans) != 3 {
+		t.Fatalf("first run exported %d spans, want 3", len(spans))
+	}
+
+	// Garbage of the same size and modification time is not noticed, as
+	// the archive is not opened again.
+	st, err := os.Stat(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archive, bytes.Repeat([]byte{'x'}, int(st.Size())), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(archive, st.ModTime(), st.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if spans, bad := exportOnce(t, cfg); len(spans) != 0 || bad != 0 {
+		t.Fatalf("second run exported %d spans and rejected %d records, want 0 and 0", len(spans), bad)
+	}
+}
+
+func writeGzip(t *testing.T, path string, b []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowStopsAtInterrupt(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.txt")
+	cfg := config{inputs: []string{live}, follow: true, poll: time.Hour, checkpoint: filepath.Join(dir, "checkpoint.json")}
+	appendFile(t, live, spanLines(t, 3))
+
+	exp := tracetest.NewInMemoryExporter()
+	b := newBatcher(exp, 10, time.Second)
+	dl, err := openDeadLetter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- follow(cfg, b, dl, func(s tracetest.SpanStub) error {
+			if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+				return err
+			}
+			// Give the signal time to arrive before the next record.
+			time.Sleep(100 * time.Millisecond)
+			return b.add(s)
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("follow did not stop when interrupted")
+	}
+	if n := len(exp.GetSpans()); n != 1 {
+		t.Fatalf("exported %d spans before stopping, want 1", n)
+	}
+
+	cfg.follow = false
+	if spans, _ := exportOnce(t, cfg); len(spans) != 2 {
+		t.Fatalf("resumed run exported %d spans, want 2", len(spans))
+	}
+}
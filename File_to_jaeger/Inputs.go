@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// inputFile is an opened input, decompressed if it starts with the gzip or
+// zstd magic number.
+type inputFile struct {
+	io.Reader
+	file       *os.File
+	compressed bool
+	release    func()
+}
+
+// openInput opens path, or standard input for "-".
+func openInput(path string) (*inputFile, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+	}
+	in := &inputFile{file: f}
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			in.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		in.Reader, in.compressed = zr, true
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			in.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		in.Reader, in.compressed, in.release = zr, true, zr.Close
+	default:
+		in.Reader = br
+	}
+	return in, nil
+}
+
+// skip moves past the first offset bytes of the input. A plain file is
+// seeked; compressed data has to be decompressed and thrown away.
+func (in *inputFile) skip(offset int64) error {
+	if offset == 0 {
+		return nil
+	}
+	if !in.compressed && in.file != os.Stdin {
+		if _, err := in.file.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		in.Reader = in.file
+		return nil
+	}
+	if _, err := io.CopyN(io.Discard, in.Reader, offset); err != nil {
+		return fmt.Errorf("skipping to offset %d: %w", offset, err)
+	}
+	return nil
+}
+
+func (in *inputFile) Close() error {
+	if in.release != nil {
+		in.release()
+	}
+	if in.file == os.Stdin {
+		return nil
+	}
+	return in.file.Close()
+}
+
+// rotatedName matches the copies log rotation leaves behind, file.1,
+// file.2 and so on, once any compression suffix is removed.
+var rotatedName = regexp.MustCompile(`^(.+)\.(\d+)$`)
+
+// rotationKey returns the live file name was rotated from and how many
+// rotations ago; 0 for the live file itself.
+func rotationKey(name string) (string, int) {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	if m := rotatedName.FindStringSubmatch(name); m != nil {
+		gen, err := strconv.Atoi(m[2])
+		if err == nil {
+			return m[1], gen
+		}
+	}
+	return name, 0
+}
+
+// sortRotated sorts paths by name, except that the rotated copies of a file
+// come before it, oldest first, so spans are read in the order they were
+// written.
+func sortRotated(paths []string) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		bi, gi := rotationKey(paths[i])
+		bj, gj := rotationKey(paths[j])
+		if bi != bj {
+			return bi < bj
+		}
+		return gi > gj
+	})
+}
+
+// rotatedSet returns path preceded by its rotated copies, oldest first.
+func rotatedSet(path string) ([]string, error) {
+	matches, err := filepath.Glob(globEscape(path) + ".*")
+	if err != nil {
+		return nil, err
+	}
+	set := []string{path}
+	for _, m := range matches {
+		if base, gen := rotationKey(m); base == path && gen > 0 {
+			set = append(set, m)
+		}
+	}
+	sortRotated(set)
+	return set, nil
+}
+
+func globEscape(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// expandInputs turns the inputs given on the command line into a list of
+// files. Globs are expanded and a directory stands for the files directly
+// inside it; both are sorted by sortRotated. "-" and plain paths are kept as
+// they are. With rotated every file is replaced by its rotated set. A file
+// named more than once is read once.
+func expandInputs(inputs []string, rotated bool) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	add := func(path string) error {
+		set := []string{path}
+		if rotated && path != "-" {
+			var err error
+			if set, err = rotatedSet(path); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		for _, p := range set {
+			if !seen[p] {
+				seen[p] = true
+				files = append(files, p)
+			}
+		}
+		return nil
+	}
+
+	for _, in := range inputs {
+		paths := []string{in}
+		if in != "-" && strings.ContainsAny(in, "*?[") {
+			var err error
+			if paths, err = filepath.Glob(in); err != nil {
+				return nil, fmt.Errorf("%s: %w", in, err)
+			}
+			sortRotated(paths)
+		}
+		for _, p := range paths {
+			st, err := os.Stat(p)
+			if err != nil || !st.IsDir() {
+				// Missing files are reported when they are opened.
+				if err := add(p); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			entries, err := os.ReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			var dir []string
+			for _, e := range entries {
+				if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+					dir = append(dir, filepath.Join(p, e.Name()))
+				}
+			}
+			sortRotated(dir)
+			for _, f := range dir {
+				if err := add(f); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// mergeTraces orders spans read from several files so that the spans of a
+// trace are next to each other, traces follow each other by their earliest
+// start time and the spans of a trace are in start time order.
+func mergeTraces(s tracetest.SpanStubs) {
+	first := map[trace.TraceID]time.Time{}
+	for _, sp := range s {
+		id := sp.SpanContext.TraceID()
+		if t, ok := first[id]; !ok || sp.StartTime.Before(t) {
+			first[id] = sp.StartTime
+		}
+	}
+	sort.SliceStable(s, func(i, j int) bool {
+		a, b := s[i].SpanContext.TraceID(), s[j].SpanContext.TraceID()
+		if a != b {
+			if fa, fb := first[a], first[b]; !fa.Equal(fb) {
+				return fa.Before(fb)
+			}
+			return bytes.Compare(a[:], b[:]) < 0
+		}
+		return s[i].StartTime.Before(s[j].StartTime)
+	})
+}
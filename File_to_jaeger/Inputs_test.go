@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandInputsRotated(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs")
+	if err := os.Mkdir(logs, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"finaltrace.txt", "finaltrace.txt.1", "finaltrace.txt.2.gz", "other.log",
+		"logs/app.txt", "logs/app.txt.1",
+	} {
+		appendFile(t, filepath.Join(dir, name), nil)
+	}
+	join := func(names ...string) []string {
+		for i, n := range names {
+			names[i] = filepath.Join(dir, n)
+		}
+		return names
+	}
+
+	for _, tc := range []struct {
+		inputs  []string
+		rotated bool
+		want    []string
+	}{
+		{join("finaltrace*.txt"), false, join("finaltrace.txt")},
+		{join("finaltrace*.txt"), true, join("finaltrace.txt.2.gz", "finaltrace.txt.1", "finaltrace.txt")},
+		{join("finaltrace.txt"), true, join("finaltrace.txt.2.gz", "finaltrace.txt.1", "finaltrace.txt")},
+		{join("logs"), true, join("logs/app.txt.1", "logs/app.txt")},
+		// A copy named on its own is read once, before the live file.
+		{join("finaltrace.txt.1", "finaltrace*.txt"), true, join("finaltrace.txt.1", "finaltrace.txt.2.gz", "finaltrace.txt")},
+	} {
+		got, err := expandInputs(tc.inputs, tc.rotated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("expandInputs(%v, %v) = %v, want %v", tc.inputs, tc.rotated, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The JSON Jaeger UI loads with "Upload JSON", as served by its query API.
+// Times and durations are in microseconds.
+type jaegerFile struct {
+	Data []jaegerTrace `json:"data"`
+}
+
+type jaegerTrace struct {
+	TraceID   string                   `json:"traceID"`
+	Spans     []jaegerSpan             `json:"spans"`
+	Processes map[string]jaegerProcess `json:"processes"`
+	Warnings  []string                 `json:"warnings"`
+}
+
+type jaegerSpan struct {
+	TraceID       string            `json:"traceID"`
+	SpanID        string            `json:"spanID"`
+	Flags         int               `json:"flags"`
+	OperationName string            `json:"operationName"`
+	References    []jaegerReference `json:"references"`
+	StartTime     int64             `json:"startTime"`
+	Duration      int64             `json:"duration"`
+	Tags          []jaegerTag       `json:"tags"`
+	Logs          []jaegerLog       `json:"logs"`
+	ProcessID     string            `json:"processID"`
+	Warnings      []string          `json:"warnings"`
+}
+
+type jaegerReference struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+type jaegerTag struct {
+	Key   string      `json:"key"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type jaegerLog struct {
+	Timestamp int64       `json:"timestamp"`
+	Fields    []jaegerTag `json:"fields"`
+}
+
+type jaegerProcess struct {
+	ServiceName string      `json:"serviceName"`
+	Tags        []jaegerTag `json:"tags"`
+}
+
+// writeJaegerJSON writes spans grouped by trace, with one process per
+// distinct resource in each trace. Span kind, status, instrumentation
+// library and links become tags and references the way the Jaeger exporter
+// maps them.
+func writeJaegerJSON(w io.Writer, spans tracetest.SpanStubs) error {
+	file := jaegerFile{Data: []jaegerTrace{}}
+	for _, t := range assemble(spans) {
+		jt := jaegerTrace{
+			TraceID:   t.id.String(),
+			Spans:     []jaegerSpan{},
+			Processes: map[string]jaegerProcess{},
+		}
+		processes := map[attribute.Distinct]string{}
+		for _, s := range t.spans {
+			res := s.Resource
+			if res == nil {
+				res = resource.Empty()
+			}
+			pid, ok := processes[res.Equivalent()]
+			if !ok {
+				pid = fmt.Sprintf("p%d", len(processes)+1)
+				processes[res.Equivalent()] = pid
+				jt.Processes[pid] = jaegerProcessOf(s)
+			}
+			jt.Spans = append(jt.Spans, jaegerSpanOf(s, pid))
+		}
+		file.Data = append(file.Data, jt)
+	}
+	return json.NewEncoder(w).Encode(file)
+}
+
+func jaegerProcessOf(s tracetest.SpanStub) jaegerProcess {
+	p := jaegerProcess{ServiceName: serviceName(s), Tags: []jaegerTag{}}
+	if s.Resource != nil {
+		for _, kv := range s.Resource.Attributes() {
+			if kv.Key != "service.name" {
+				p.Tags = append(p.Tags, jaegerTagOf(kv))
+			}
+		}
+	}
+	return p
+}
+
+func jaegerSpanOf(s tracetest.SpanStub, pid string) jaegerSpan {
+	js := jaegerSpan{
+		TraceID:       s.SpanContext.TraceID().String(),
+		SpanID:        s.SpanContext.SpanID().String(),
+		Flags:         int(s.SpanContext.TraceFlags()),
+		OperationName: s.Name,
+		References:    []jaegerReference{},
+		StartTime:     s.StartTime.UnixMicro(),
+		Duration:      s.EndTime.Sub(s.StartTime).Microseconds(),
+		Tags:          []jaegerTag{},
+		Logs:          []jaegerLog{},
+		ProcessID:     pid,
+	}
+	if s.Parent.IsValid() {
+		js.References = append(js.References, jaegerRefOf("CHILD_OF", s.Parent))
+	}
+	for _, l := range s.Links {
+		js.References = append(js.References, jaegerRefOf("FOLLOWS_FROM", l.SpanContext))
+	}
+
+	for _, kv := range s.Attributes {
+		js.Tags = append(js.Tags, jaegerTagOf(kv))
+	}
+	if s.SpanKind != trace.SpanKindInternal && s.SpanKind != trace.SpanKindUnspecified {
+		js.Tags = append(js.Tags, jaegerTagOf(attribute.String("span.kind", s.SpanKind.String())))
+	}
+	if s.Status.Code != codes.Unset {
+		js.Tags = append(js.Tags, jaegerTagOf(attribute.String("otel.status_code", strings.ToUpper(s.Status.Code.String()))))
+		if s.Status.Description != "" {
+			js.Tags = append(js.Tags, jaegerTagOf(attribute.String("otel.status_description", s.Status.Description)))
+		}
+	}
+	if s.Status.Code == codes.Error {
+		js.Tags = append(js.Tags, jaegerTagOf(attribute.Bool("error", true)))
+	}
+	if lib := s.InstrumentationLibrary; lib.Name != "" {
+		js.Tags = append(js.Tags, jaegerTagOf(attribute.String("otel.library.name", lib.Name)))
+		if lib.Version != "" {
+			js.Tags = append(js.Tags, jaegerTagOf(attribute.String("otel.library.version", lib.Version)))
+		}
+	}
+
+	for _, ev := range s.Events {
+		l := jaegerLog{
+			Timestamp: ev.Time.UnixMicro(),
+			Fields:    []jaegerTag{jaegerTagOf(attribute.String("event", ev.Name))},
+		}
+		for _, kv := range ev.Attributes {
+			l.Fields = append(l.Fields, jaegerTagOf(kv))
+		}
+		js.Logs = append(js.Logs, l)
+	}
+	return js
+}
+
+func jaegerRefOf(refType string, sc trace.SpanContext) jaegerReference {
+	return jaegerReference{
+		RefType: refType,
+		TraceID: sc.TraceID().String(),
+		SpanID:  sc.SpanID().String(),
+	}
+}
+
+// jaegerTagOf maps an attribute to a Jaeger tag. Jaeger has no slice type,
+// so slices are written as JSON strings like the Jaeger exporter does.
+func jaegerTagOf(kv attribute.KeyValue) jaegerTag {
+	t := jaegerTag{Key: string(kv.Key)}
+	switch kv.Value.Type() {
+	case attribute.BOOL:
+		t.Type, t.Value = "bool", kv.Value.AsBool()
+	case attribute.INT64:
+		t.Type, t.Value = "int64", kv.Value.AsInt64()
+	case attribute.FLOAT64:
+		t.Type, t.Value = "float64", kv.Value.AsFloat64()
+	case attribute.BOOLSLICE, attribute.INT64SLICE, attribute.FLOAT64SLICE, attribute.STRINGSLICE:
+		b, _ := json.Marshal(kv.Value.AsInterface())
+		t.Type, t.Value = "string", string(b)
+	default:
+		t.Type, t.Value = "string", kv.Value.Emit()
+	}
+	return t
+}
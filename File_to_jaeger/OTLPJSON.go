@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// The OTLP/JSON encoding of an ExportTraceServiceRequest, as read by the
+// Collector's otlpjsonfile receiver. IDs are hex, 64 bit integers and
+// nanosecond timestamps are strings and empty fields are left out.
+type otlpRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource      `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+	SchemaURL  string            `json:"schemaUrl,omitempty"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope     otlpScope  `json:"scope"`
+	Spans     []otlpSpan `json:"spans"`
+	SchemaURL string     `json:"schemaUrl,omitempty"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	TraceState             string         `json:"traceState,omitempty"`
+	ParentSpanID           string         `json:"parentSpanId,omitempty"`
+	Flags                  uint32         `json:"flags,omitempty"`
+	Name                   string         `json:"name"`
+	Kind                   int            `json:"kind,omitempty"`
+	StartTimeUnixNano      string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano        string         `json:"endTimeUnixNano"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+	Events                 []otlpEvent    `json:"events,omitempty"`
+	DroppedEventsCount     int            `json:"droppedEventsCount,omitempty"`
+	Links                  []otlpLink     `json:"links,omitempty"`
+	DroppedLinksCount      int            `json:"droppedLinksCount,omitempty"`
+	Status                 otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano           string         `json:"timeUnixNano"`
+	Name                   string         `json:"name"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	TraceState             string         `json:"traceState,omitempty"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+}
+
+type otlpStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+// OTLP numbers its status codes differently from the codes package.
+var otlpStatusCodes = map[codes.Code]int{
+	codes.Unset: 0,
+	codes.Ok:    1,
+	codes.Error: 2,
+}
+
+// writeOTLPJSON writes spans as a single ExportTraceServiceRequest on one
+// line, grouped by resource and then by instrumentation library in the
+// order they are first seen.
+func writeOTLPJSON(w io.Writer, spans tracetest.SpanStubs) error {
+	req := otlpRequest{ResourceSpans: []*otlpResourceSpans{}}
+	resources := map[attribute.Distinct]*otlpResourceSpans{}
+	scopes := map[attribute.Distinct]map[instrumentation.Library]*otlpScopeSpans{}
+	for _, s := range spans {
+		res := s.Resource
+		if res == nil {
+			res = resource.Empty()
+		}
+		key := res.Equivalent()
+		rs, ok := resources[key]
+		if !ok {
+			rs = &otlpResourceSpans{
+				Resource:  otlpResource{Attributes: otlpAttrs(res.Attributes())},
+				SchemaURL: res.SchemaURL(),
+			}
+			resources[key] = rs
+			scopes[key] = map[instrumentation.Library]*otlpScopeSpans{}
+			req.ResourceSpans = append(req.ResourceSpans, rs)
+		}
+		lib := s.InstrumentationLibrary
+		ss, ok := scopes[key][lib]
+		if !ok {
+			ss = &otlpScopeSpans{
+				Scope:     otlpScope{Name: lib.Name, Version: lib.Version},
+				SchemaURL: lib.SchemaURL,
+			}
+			scopes[key][lib] = ss
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+		}
+		ss.Spans = append(ss.Spans, otlpSpanOf(s))
+	}
+	return json.NewEncoder(w).Encode(req)
+}
+
+func otlpSpanOf(s tracetest.SpanStub) otlpSpan {
+	out := otlpSpan{
+		TraceID:    s.SpanContext.TraceID().String(),
+		SpanID:     s.SpanContext.SpanID().String(),
+		TraceState: s.SpanContext.TraceState().String(),
+		Flags:      uint32(s.SpanContext.TraceFlags()),
+		Name:       s.Name,
+		// trace.SpanKind numbers the kinds the way OTLP does.
+		Kind:                   int(s.SpanKind),
+		StartTimeUnixNano:      otlpTime(s.StartTime.UnixNano()),
+		EndTimeUnixNano:        otlpTime(s.EndTime.UnixNano()),
+		Attributes:             otlpAttrs(s.Attributes),
+		DroppedAttributesCount: s.DroppedAttributes,
+		DroppedEventsCount:     s.DroppedEvents,
+		DroppedLinksCount:      s.DroppedLinks,
+		Status: otlpStatus{
+			Message: s.Status.Description,
+			Code:    otlpStatusCodes[s.Status.Code],
+		},
+	}
+	if s.Parent.IsValid() {
+		out.ParentSpanID = s.Parent.SpanID().String()
+	}
+	for _, ev := range s.Events {
+		out.Events = append(out.Events, otlpEvent{
+			TimeUnixNano:           otlpTime(ev.Time.UnixNano()),
+			Name:                   ev.Name,
+			Attributes:             otlpAttrs(ev.Attributes),
+			DroppedAttributesCount: ev.DroppedAttributeCount,
+		})
+	}
+	for _, l := range s.Links {
+		out.Links = append(out.Links, otlpLink{
+			TraceID:                l.SpanContext.TraceID().String(),
+			SpanID:                 l.SpanContext.SpanID().String(),
+			TraceState:             l.SpanContext.TraceState().String(),
+			Attributes:             otlpAttrs(l.Attributes),
+			DroppedAttributesCount: l.DroppedAttributeCount,
+		})
+	}
+	return out
+}
+
+func otlpTime(ns int64) string {
+	return strconv.FormatInt(ns, 10)
+}
+
+func otlpAttrs(kvs []attribute.KeyValue) []otlpKeyValue {
+	var out []otlpKeyValue
+	for _, kv := range kvs {
+		out = append(out, otlpKeyValue{Key: string(kv.Key), Value: otlpValue(kv.Value)})
+	}
+	return out
+}
+
+func otlpValue(v attribute.Value) otlpAnyValue {
+	var av otlpAnyValue
+	switch v.Type() {
+	case attribute.BOOL:
+		b := v.AsBool()
+		av.BoolValue = &b
+	case attribute.INT64:
+		n := strconv.FormatInt(v.AsInt64(), 10)
+		av.IntValue = &n
+	case attribute.FLOAT64:
+		f := v.AsFloat64()
+		av.DoubleValue = &f
+	case attribute.STRING:
+		s := v.AsString()
+		av.StringValue = &s
+	case attribute.BOOLSLICE:
+		av.ArrayValue = otlpArray(v.AsBoolSlice(), attribute.BoolValue)
+	case attribute.INT64SLICE:
+		av.ArrayValue = otlpArray(v.AsInt64Slice(), attribute.Int64Value)
+	case attribute.FLOAT64SLICE:
+		av.ArrayValue = otlpArray(v.AsFloat64Slice(), attribute.Float64Value)
+	case attribute.STRINGSLICE:
+		av.ArrayValue = otlpArray(v.AsStringSlice(), attribute.StringValue)
+	}
+	return av
+}
+
+func otlpArray[T any](vs []T, value func(T) attribute.Value) *otlpArrayValue {
+	a := &otlpArrayValue{Values: []otlpAnyValue{}}
+	for _, v := range vs {
+		a.Values = append(a.Values, otlpValue(value(v)))
+	}
+	return a
+}
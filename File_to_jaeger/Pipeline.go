@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"time"
+
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// eachSpan decodes the inputs in order and passes every converted span to fn
+// as soon as it is read, so no input is ever held in memory as a whole.
+// Records that cannot be converted are handed to dl.
+func eachSpan(inputs []string, rotated bool, dl *deadLetter, fn func(tracetest.SpanStub) error) error {
+	files, err := expandInputs(inputs, rotated)
+	if err != nil {
+		return err
+	}
+	for _, in := range files {
+		f, err := openInput(in)
+		if err != nil {
+			return err
+		}
+		var last int64
+		err = decodeSpans(f, func(s tracetest.SpanStub, end int64) error {
+			last = end
+			return fn(s)
+		}, func(r badRecord) error {
+			last = r.End
+			return dl.add(in, r)
+		})
+		f.Close()
+		if err == io.ErrUnexpectedEOF {
+			// Start is only known to be past the last complete record.
+			err = dl.add(in, badRecord{Start: last, End: last, Err: errors.New("record cut short by the end of the input")})
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", in, err)
+		}
+	}
+	return nil
+}
+
+// eachMerged reads all the inputs before passing their spans to fn, grouped
+// by trace and in start time order. Unlike eachSpan it holds every span in
+// memory.
+func eachMerged(inputs []string, rotated bool, dl *deadLetter, fn func(tracetest.SpanStub) error) error {
+	var all tracetest.SpanStubs
+	err := eachSpan(inputs, rotated, dl, func(s tracetest.SpanStub) error {
+		all = append(all, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	mergeTraces(all)
+	for _, s := range all {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachTrace reads all the inputs and passes them to fn assembled into
+// traces. Like eachMerged it holds every span in memory.
+func eachTrace(inputs []string, rotated bool, dl *deadLetter, fn func(*assembledTrace) error) error {
+	var all tracetest.SpanStubs
+	err := eachSpan(inputs, rotated, dl, func(s tracetest.SpanStub) error {
+		all = append(all, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range assemble(all) {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSpans reads the inputs of cfg the way its flags ask for and passes
+// the spans selected by the filter to fn. With -keep-traces a span that
+// matches keeps every span of its trace. With -sample only the traces kept
+// by the sampling policies are passed on. -rebase now reads the traces
+// whole as well, to anchor on them.
+func readSpans(cfg config, dl *deadLetter, fn func(tracetest.SpanStub) error) error {
+	if cfg.filter != nil && !cfg.keepTraces {
+		fn = filtered(cfg.filter, fn)
+	}
+	if cfg.keepTraces || cfg.sampler != nil || cfg.rebase.needsTraces() {
+		var kept []*assembledTrace
+		err := eachTrace(cfg.inputs, cfg.rotated, dl, func(t *assembledTrace) error {
+			if cfg.keepTraces && cfg.filter != nil && !anyMatch(cfg.filter, t.spans) {
+				return nil
+			}
+			if cfg.sampler != nil && !cfg.sampler.keep(t) {
+				return nil
+			}
+			kept = append(kept, t)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// -rebase now anchors on all the traces, so none is passed on
+		// before it has seen them.
+		cfg.rebase.anchor(kept)
+		for _, t := range kept {
+			for _, s := range t.spans {
+				if err := fn(s); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if cfg.merge {
+		return eachMerged(cfg.inputs, cfg.rotated, dl, fn)
+	}
+	return eachSpan(cfg.inputs, cfg.rotated, dl, fn)
+}
+
+// transformed applies each transform to a span, in order, before passing it
+// to fn.
+func transformed(transforms []func(*tracetest.SpanStub), fn func(tracetest.SpanStub) error) func(tracetest.SpanStub) error {
+	if len(transforms) == 0 {
+		return fn
+	}
+	return func(s tracetest.SpanStub) error {
+		for _, t := range transforms {
+			t(&s)
+		}
+		return fn(s)
+	}
+}
+
+// batcher collects converted spans and exports them size at a time. Only one
+// batch is kept in memory, however large the input is.
+type batcher struct {
+	exp      tracesdk.SpanExporter
+	size     int
+	timeout  time.Duration
+	spans    tracetest.SpanStubs
+	exported int
+
+	// retries is how many times a failed export is retried, waiting a
+	// random time of up to backoff, doubled after every attempt, in between.
+	retries int
+	backoff time.Duration
+	// queue, if set, takes the batches that still fail and is drained once
+	// an export succeeds again.
+	queue   *spool
+	spooled int
+
+	// spanRate and byteRate, if set, pace the export requests.
+	spanRate, byteRate *rateLimiter
+	// progress, if set, is how often the spans exported so far are logged,
+	// counting from lastProgress.
+	progress     time.Duration
+	sentBytes    int
+	lastProgress time.Time
+	lastExported int
+	lastBytes    int
+
+	// dedup, if set, drops spans that were already exported.
+	dedup *dedup
+	// flushed, if set, is called after every flush that did not fail.
+	flushed func() error
+}
+
+func newBatcher(exp tracesdk.SpanExporter, size int, timeout time.Duration) *batcher {
+	return &batcher{
+		exp:     exp,
+		size:    size,
+		timeout: timeout,
+		spans:   make(tracetest.SpanStubs, 0, size),
+	}
+}
+
+func (b *batcher) add(s tracetest.SpanStub) error {
+	if b.dedup != nil && b.dedup.seen(s) {
+		return nil
+	}
+	b.spans = append(b.spans, s)
+	if len(b.spans) < b.size {
+		return nil
+	}
+	return b.flush()
+}
+
+// flush exports the spans collected so far and starts a new batch. With
+// nothing to export it tries to drain the queue instead.
+func (b *batcher) flush() error {
+	if len(b.spans) > 0 {
+		if err := b.export(); err != nil {
+			return err
+		}
+	} else {
+		b.drain()
+	}
+	if b.flushed != nil {
+		return b.flushed()
+	}
+	return nil
+}
+
+func (b *batcher) export() error {
+	err := b.send(b.spans, b.retries)
+	switch {
+	case err == nil:
+		b.exported += len(b.spans)
+		b.report()
+		b.drain()
+	case b.queue != nil:
+		log.Printf("export failed, spooling %d spans to %s: %v", len(b.spans), b.queue.dir, err)
+		if err = b.queue.put(b.spans); err == nil {
+			b.spooled += len(b.spans)
+		}
+	}
+	// Spooled spans count as exported for the index: they are sent from
+	// the queue, not read again from the inputs.
+	if err == nil && b.dedup != nil {
+		err = b.dedup.record(b.spans)
+	}
+	b.spans = b.spans[:0]
+	return err
+}
+
+// maxBackoff caps the wait between two export attempts.
+const maxBackoff = 30 * time.Second
+
+// send exports spans, retrying up to retries times with exponential backoff
+// and full jitter.
+func (b *batcher) send(spans tracetest.SpanStubs, retries int) error {
+	size := 0
+	if b.byteRate != nil || b.progress > 0 {
+		for _, s := range spans {
+			size += spanSize(s)
+		}
+	}
+	delay := b.backoff
+	for attempt := 0; ; attempt++ {
+		// Retries count against the limits too; they load the collector
+		// just the same.
+		b.spanRate.wait(float64(len(spans)))
+		b.byteRate.wait(float64(size))
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		err := b.exp.ExportSpans(ctx, spans.Snapshots())
+		cancel()
+		if err == nil {
+			b.sentBytes += size
+		}
+		if err == nil || attempt >= retries || delay <= 0 {
+			return err
+		}
+		wait := time.Duration(rand.Int63n(int64(delay))) + 1
+		log.Printf("export failed, retrying in %v: %v", wait.Round(time.Millisecond), err)
+		time.Sleep(wait)
+		delay = min(2*delay, maxBackoff)
+	}
+}
+
+// drain sends the spooled batches, if there are any. Each gets one attempt,
+// so an outage costs no more than the first failure; what fails stays in
+// the queue.
+func (b *batcher) drain() {
+	if b.queue == nil || b.queue.pending == 0 {
+		return
+	}
+	n, err := b.queue.drain(func(spans tracetest.SpanStubs) error {
+		return b.send(spans, 0)
+	})
+	b.exported += n
+	b.report()
+	if n > 0 {
+		log.Printf("sent %d spooled spans from %s, %d batches left", n, b.queue.dir, b.queue.pending)
+	}
+	if err != nil {
+		log.Printf("queue %s not drained: %v", b.queue.dir, err)
+	}
+}
+
+// report logs the spans and bytes exported so far and the rates since the
+// last report, at most once every b.progress.
+func (b *batcher) report() {
+	if b.progress <= 0 {
+		return
+	}
+	now := time.Now()
+	d := now.Sub(b.lastProgress)
+	if d < b.progress {
+		return
+	}
+	log.Printf("progress: %d spans, %d KB exported; %.0f spans/s, %.1f KB/s",
+		b.exported, b.sentBytes/1024,
+		float64(b.exported-b.lastExported)/d.Seconds(),
+		float64(b.sentBytes-b.lastBytes)/1024/d.Seconds())
+	b.lastProgress, b.lastExported, b.lastBytes = now, b.exported, b.sentBytes
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spool is a directory of batches that could not be exported. Each batch
+// is a file in the stdouttrace format the inputs are in, named so that
+// sorting the names gives the order they were spooled in.
+type spool struct {
+	dir     string
+	pending int
+	seq     int
+}
+
+func openSpool(dir string) (*spool, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	q := &spool{dir: dir}
+	names, err := q.batches()
+	if err != nil {
+		return nil, err
+	}
+	q.pending = len(names)
+	return q, nil
+}
+
+func (q *spool) batches() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(globEscape(q.dir), "batch-*.json"))
+	sort.Strings(names)
+	return names, err
+}
+
+// put writes spans to a new batch file.
+func (q *spool) put(spans tracetest.SpanStubs) error {
+	q.seq++
+	name := filepath.Join(q.dir, fmt.Sprintf("batch-%020d-%06d.json", time.Now().UnixNano(), q.seq))
+	err := writeFileAtomic(name, func(w io.Writer) error {
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return err
+		}
+		return exp.ExportSpans(context.Background(), spans.Snapshots())
+	})
+	if err != nil {
+		return err
+	}
+	q.pending++
+	return nil
+}
+
+// drain sends the spooled batches, oldest first, and removes each one that
+// was sent. It stops at the first batch that fails, leaving it and the
+// later ones for the next attempt, and returns the number of spans sent.
+func (q *spool) drain(send func(tracetest.SpanStubs) error) (int, error) {
+	names, err := q.batches()
+	if err != nil {
+		return 0, err
+	}
+	q.pending = len(names)
+	sent := 0
+	for _, name := range names {
+		var spans tracetest.SpanStubs
+		f, err := os.Open(name)
+		if err != nil {
+			return sent, err
+		}
+		err = decodeSpans(f, func(s tracetest.SpanStub, _ int64) error {
+			spans = append(spans, s)
+			return nil
+		}, func(r badRecord) error {
+			return fmt.Errorf("%s: offset %d: %w", name, r.Start, r.Err)
+		})
+		f.Close()
+		if err != nil {
+			return sent, err
+		}
+		if err := send(spans); err != nil {
+			return sent, err
+		}
+		if err := os.Remove(name); err != nil {
+			return sent, err
+		}
+		q.pending--
+		sent += len(spans)
+	}
+	return sent, nil
+}
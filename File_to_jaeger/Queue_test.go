@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAndSpool(t *testing.T) {
+	recv := &otlpReceiver{}
+	var failing atomic.Bool
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		recv.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	cfg := config{output: "otlp-http", endpoint: srv.URL, timeout: 5 * time.Second, compression: "none"}
+	dir := t.TempDir()
+	newTestBatcher := func() *batcher {
+		t.Helper()
+		exp, err := newExporter(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := newBatcher(exp, 10, cfg.timeout)
+		b.retries, b.backoff = 2, time.Millisecond
+		if b.queue, err = openSpool(dir); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	addAll := func(b *batcher) {
+		t.Helper()
+		for _, s := range testSpans(t) {
+			if err := b.add(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := b.export(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A failing collector gets the batch once plus once per retry, then
+	// the batch is spooled.
+	failing.Store(true)
+	b := newTestBatcher()
+	addAll(b)
+	if n := requests.Load(); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+	if b.spooled != 2 || b.exported != 0 || b.queue.pending != 1 {
+		t.Errorf("spooled %d, exported %d, %d batches pending; want 2, 0, 1", b.spooled, b.exported, b.queue.pending)
+	}
+
+	// Once the collector is back, the next successful export drains the
+	// queue.
+	failing.Store(false)
+	addAll(b)
+	if got := len(recv.received()); got != 4 {
+		t.Errorf("collector has %d spans, want 4", got)
+	}
+	if b.exported != 4 || b.queue.pending != 0 {
+		t.Errorf("exported %d, %d batches pending; want 4, 0", b.exported, b.queue.pending)
+	}
+
+	// What is still spooled at the end of a run goes out at the start of
+	// the next one.
+	failing.Store(true)
+	addAll(b)
+	failing.Store(false)
+	next := newTestBatcher()
+	if next.queue.pending != 1 {
+		t.Fatalf("%d batches pending for the next run, want 1", next.queue.pending)
+	}
+	next.drain()
+	if got := len(recv.received()); got != 6 {
+		t.Errorf("collector has %d spans, want 6", got)
+	}
+	if next.exported != 2 || next.queue.pending != 0 {
+		t.Errorf("next run exported %d, %d batches pending; want 2, 0", next.exported, next.queue.pending)
+	}
+	names, err := next.queue.batches()
+	if err != nil || len(names) != 0 {
+		t.Errorf("queue directory still holds %v (%v)", names, err)
+	}
+
+	// Spans that cannot be spooled either are not counted as spooled.
+	failing.Store(true)
+	b = newTestBatcher()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range testSpans(t) {
+		b.add(s)
+	}
+	if err := b.export(); err == nil {
+		t.Error("export into a missing queue directory did not fail")
+	}
+	if b.spooled != 0 {
+		t.Errorf("spooled %d spans, want 0", b.spooled)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// rateLimiter is a token bucket holding up to a second's worth of tokens.
+// A batch takes what it needs even when that is more than the bucket holds,
+// and the sender then sleeps off the debt, so large batches are spread out
+// as evenly as small ones.
+type rateLimiter struct {
+	rate   float64 // tokens per second
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// wait takes n tokens, sleeping until they have been earned.
+func (l *rateLimiter) wait(n float64) {
+	if l == nil {
+		return
+	}
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= n
+	if l.tokens < 0 {
+		time.Sleep(time.Duration(-l.tokens / l.rate * float64(time.Second)))
+		l.tokens = 0
+		l.last = time.Now()
+	}
+}
+
+// spanSize estimates how many bytes s takes on the wire from its names, IDs
+// and attributes. The exporters encode spans differently, so this is only
+// good for pacing.
+func spanSize(s tracetest.SpanStub) int {
+	n := 64 + len(s.Name) + attrsSize(s.Attributes)
+	for _, ev := range s.Events {
+		n += 16 + len(ev.Name) + attrsSize(ev.Attributes)
+	}
+	for _, l := range s.Links {
+		n += 32 + attrsSize(l.Attributes)
+	}
+	if s.Resource != nil {
+		n += attrsSize(s.Resource.Attributes())
+	}
+	return n
+}
+
+func attrsSize(kvs []attribute.KeyValue) int {
+	n := 0
+	for _, kv := range kvs {
+		n += 4 + len(kv.Key) + len(kv.Value.Emit())
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// rebaser shifts span and event timestamps by an offset, so old
+// recordings fall inside Jaeger's search window. With toNow the offset is
+// set by anchor so the latest span of the run ends at the current time, or
+// with perTrace so the latest span of every trace does; nothing ends up in
+// the future either way.
+type rebaser struct {
+	offset   time.Duration
+	toNow    bool
+	perTrace bool
+
+	traces map[trace.TraceID]time.Duration
+	now    func() time.Time
+}
+
+// parseRebase parses the -rebase flag: "now" or a duration such as 336h.
+func parseRebase(spec string) (*rebaser, error) {
+	r := &rebaser{now: time.Now, traces: map[trace.TraceID]time.Duration{}}
+	if spec == "now" {
+		r.toNow = true
+		return r, nil
+	}
+	d, err := time.ParseDuration(spec)
+	if err != nil {
+		return nil, fmt.Errorf("rebase: want \"now\" or a duration, got %q", spec)
+	}
+	r.offset = d
+	return r, nil
+}
+
+// needsTraces reports whether r has to see the traces it shifts, through
+// anchor, before shifting any span.
+func (r *rebaser) needsTraces() bool {
+	return r != nil && r.toNow
+}
+
+// anchor sets the offsets of -rebase now from the traces about to be
+// exported.
+func (r *rebaser) anchor(traces []*assembledTrace) {
+	if !r.needsTraces() {
+		return
+	}
+	now := r.now()
+	var latest time.Time
+	for _, t := range traces {
+		var end time.Time
+		for _, s := range t.spans {
+			if s.EndTime.After(end) {
+				end = s.EndTime
+			}
+		}
+		r.traces[t.id] = now.Sub(end)
+		if end.After(latest) {
+			latest = end
+		}
+	}
+	r.offset = now.Sub(latest)
+}
+
+func (r *rebaser) apply(s *tracetest.SpanStub) {
+	d := r.offset
+	if r.toNow && r.perTrace {
+		d = r.traces[s.SpanContext.TraceID()]
+	}
+
+	s.StartTime = s.StartTime.Add(d)
+	s.EndTime = s.EndTime.Add(d)
+	if len(s.Events) > 0 {
+		// The events may be shared with the span as it was read.
+		events := append(s.Events[:0:0], s.Events...)
+		for i := range events {
+			events[i].Time = events[i].Time.Add(d)
+		}
+		s.Events = events
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRebaseNowEndsAtNow(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	span := func(tid byte, sid byte, start, end time.Duration) tracetest.SpanStub {
+		return tracetest.SpanStub{
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{tid}, SpanID: trace.SpanID{sid}}),
+			StartTime:   base.Add(start),
+			EndTime:     base.Add(end),
+		}
+	}
+	// A child read before its parent, and a second trace an hour later.
+	spans := tracetest.SpanStubs{
+		span(1, 2, time.Second, 2*time.Second),
+		span(1, 1, 0, 3*time.Second),
+		span(2, 3, time.Hour, time.Hour+time.Second),
+	}
+
+	for _, perTrace := range []bool{false, true} {
+		r, err := parseRebase("now")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.now = func() time.Time { return now }
+		r.perTrace = perTrace
+		r.anchor(assemble(append(tracetest.SpanStubs(nil), spans...)))
+
+		var got tracetest.SpanStubs
+		for _, s := range spans {
+			r.apply(&s)
+			got = append(got, s)
+		}
+		var latest time.Time
+		for _, s := range got {
+			if s.EndTime.After(latest) {
+				latest = s.EndTime
+			}
+		}
+		if !latest.Equal(now) {
+			t.Errorf("perTrace %v: latest end %v, want %v", perTrace, latest, now)
+		}
+		if d := got[1].StartTime.Sub(got[0].StartTime); d != -time.Second {
+			t.Errorf("perTrace %v: parent starts %v after child, want -1s", perTrace, d)
+		}
+		if perTrace && !got[1].EndTime.Equal(now) {
+			t.Errorf("first trace ends at %v, want %v", got[1].EndTime, now)
+		}
+	}
+}
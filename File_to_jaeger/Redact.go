@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// envRedactKey holds the HMAC key for the hash action when -redact-key-file
+// is not given.
+const envRedactKey = "FILE_TO_JAEGER_REDACT_KEY"
+
+const redactMask = "****"
+
+// Where a redaction rule applies.
+const (
+	scopeSpan     = "span"
+	scopeEvent    = "event"
+	scopeLink     = "link"
+	scopeResource = "resource"
+)
+
+// redactRule is one entry of the rules file, for example
+//
+//	{"key": "user-id", "action": "hash"}
+//	{"key_pattern": "(?i)token|secret", "action": "drop"}
+//	{"value_pattern": "[\\w.+-]+@[\\w-]+\\.[\\w.]+", "action": "mask", "scopes": ["span", "event"]}
+//
+// A rule matches an attribute by its exact key, a key pattern or a pattern
+// found in its value. drop removes the attribute, mask replaces the value,
+// or only the matching part for value_pattern rules, and hash replaces it
+// with a keyed HMAC-SHA256, so equal values still correlate. Scopes limit
+// the rule to span, event, link or resource attributes; by default it
+// applies to all of them.
+type redactRule struct {
+	Key          string   `json:"key"`
+	KeyPattern   string   `json:"key_pattern"`
+	ValuePattern string   `json:"value_pattern"`
+	Action       string   `json:"action"`
+	Scopes       []string `json:"scopes"`
+
+	keyRe   *regexp.Regexp
+	valueRe *regexp.Regexp
+}
+
+type redactor struct {
+	rules []redactRule
+	key   []byte
+}
+
+// loadRedactor reads the rules file at path. The HMAC key is read from
+// keyFile or, failing that, from the environment.
+func loadRedactor(path, keyFile string) (*redactor, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &redactor{}
+	if err := json.Unmarshal(b, &r.rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	needKey := false
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", path, i+1, err)
+		}
+		needKey = needKey || rule.Action == "hash"
+	}
+
+	switch {
+	case keyFile != "":
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		r.key = []byte(strings.TrimSpace(string(key)))
+	default:
+		r.key = []byte(os.Getenv(envRedactKey))
+	}
+	if needKey && len(r.key) == 0 {
+		return nil, errors.New("hash rules need a key from -redact-key-file or " + envRedactKey)
+	}
+	return r, nil
+}
+
+func (rule *redactRule) compile() error {
+	switch rule.Action {
+	case "drop", "mask", "hash":
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+	if rule.Key == "" && rule.KeyPattern == "" && rule.ValuePattern == "" {
+		return errors.New("one of key, key_pattern or value_pattern is required")
+	}
+	for _, sc := range rule.Scopes {
+		switch sc {
+		case scopeSpan, scopeEvent, scopeLink, scopeResource:
+		default:
+			return fmt.Errorf("unknown scope %q", sc)
+		}
+	}
+	var err error
+	if rule.KeyPattern != "" {
+		if rule.keyRe, err = regexp.Compile(rule.KeyPattern); err != nil {
+			return err
+		}
+	}
+	if rule.ValuePattern != "" {
+		if rule.valueRe, err = regexp.Compile(rule.ValuePattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rule *redactRule) matches(scope string, kv attribute.KeyValue) bool {
+	if len(rule.Scopes) > 0 {
+		found := false
+		for _, sc := range rule.Scopes {
+			found = found || sc == scope
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.Key != "" && string(kv.Key) != rule.Key {
+		return false
+	}
+	if rule.keyRe != nil && !rule.keyRe.MatchString(string(kv.Key)) {
+		return false
+	}
+	if rule.valueRe != nil && !rule.valueRe.MatchString(kv.Value.Emit()) {
+		return false
+	}
+	return true
+}
+
+// apply redacts the span, event, link and resource attributes of s.
+func (r *redactor) apply(s *tracetest.SpanStub) {
+	s.Attributes = r.attrs(scopeSpan, s.Attributes)
+	for i := range s.Events {
+		s.Events[i].Attributes = r.attrs(scopeEvent, s.Events[i].Attributes)
+	}
+	for i := range s.Links {
+		s.Links[i].Attributes = r.attrs(scopeLink, s.Links[i].Attributes)
+	}
+	if s.Resource != nil {
+		s.Resource = resource.NewSchemaless(r.attrs(scopeResource, s.Resource.Attributes())...)
+	}
+}
+
+func (r *redactor) attrs(scope string, kvs []attribute.KeyValue) []attribute.KeyValue {
+	out := kvs[:0:0]
+	for _, kv := range kvs {
+		keep := true
+		for i := range r.rules {
+			rule := &r.rules[i]
+			if !rule.matches(scope, kv) {
+				continue
+			}
+			if rule.Action == "drop" {
+				keep = false
+				break
+			}
+			kv = r.redact(rule, kv)
+		}
+		if keep {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// redact masks or hashes the value of kv. String slices keep their type and
+// are redacted element by element; other values become strings.
+func (r *redactor) redact(rule *redactRule, kv attribute.KeyValue) attribute.KeyValue {
+	one := func(v string) string {
+		if rule.Action == "hash" {
+			m := hmac.New(sha256.New, r.key)
+			m.Write([]byte(v))
+			return hex.EncodeToString(m.Sum(nil))
+		}
+		if rule.valueRe != nil {
+			return rule.valueRe.ReplaceAllString(v, redactMask)
+		}
+		return redactMask
+	}
+	switch kv.Value.Type() {
+	case attribute.STRING:
+		return kv.Key.String(one(kv.Value.AsString()))
+	case attribute.STRINGSLICE:
+		vs := kv.Value.AsStringSlice()
+		for i := range vs {
+			vs[i] = one(vs[i])
+		}
+		return kv.Key.StringSlice(vs)
+	}
+	return kv.Key.String(one(kv.Value.Emit()))
+}
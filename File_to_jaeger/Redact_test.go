@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// writeRules writes rules to a file in a new temporary directory and
+// returns its path.
+func writeRules(t *testing.T, rules string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(rules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRedact(t *testing.T) {
+	rules := writeRules(t, `[
+		{"key_pattern": "(?i)token", "action": "drop"},
+		{"key": "password", "action": "mask"},
+		{"value_pattern": "[\\w.+-]+@[\\w-]+\\.[\\w.]+", "action": "mask", "scopes": ["span", "event"]},
+		{"key": "user", "action": "hash"},
+		{"key": "host", "action": "mask", "scopes": ["resource"]},
+		{"key": "peer", "action": "mask", "scopes": ["link"]}
+	]`)
+	// The HMAC-SHA256 test vector of RFC 4231, test case 2.
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("Jefe\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := loadRedactor(rules, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const userHash = "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+
+	mail := attribute.String("note", "mail bob@example.com now")
+	peer := attribute.String("peer", "10.0.0.1")
+	host := attribute.String("host", "db1")
+	s := tracetest.SpanStub{
+		Attributes: []attribute.KeyValue{
+			attribute.String("AuthToken", "t"),
+			attribute.Int("password", 1234),
+			attribute.String("user", "what do ya want for nothing?"),
+			mail,
+			peer,
+			host,
+			attribute.StringSlice("user", []string{"what do ya want for nothing?", "what do ya want for nothing?"}),
+			attribute.StringSlice("emails", []string{"a@b.example", "none"}),
+		},
+		Events:   []tracesdk.Event{{Name: "e", Attributes: []attribute.KeyValue{mail, peer, attribute.String("token", "t")}}},
+		Links:    []tracesdk.Link{{Attributes: []attribute.KeyValue{mail, peer, host}}},
+		Resource: resource.NewSchemaless(host, mail, attribute.String("refresh_token", "t")),
+	}
+	r.apply(&s)
+
+	masked := "mail **** now"
+	check := func(scope string, got, want []attribute.KeyValue) {
+		t.Helper()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s attributes:\n got %v\nwant %v", scope, got, want)
+		}
+	}
+	check("span", s.Attributes, []attribute.KeyValue{
+		attribute.String("password", redactMask),
+		attribute.String("user", userHash),
+		attribute.String("note", masked),
+		peer,
+		host,
+		attribute.StringSlice("user", []string{userHash, userHash}),
+		attribute.StringSlice("emails", []string{redactMask, "none"}),
+	})
+	check("event", s.Events[0].Attributes, []attribute.KeyValue{attribute.String("note", masked), peer})
+	check("link", s.Links[0].Attributes, []attribute.KeyValue{mail, attribute.String("peer", redactMask), host})
+	// Resource attributes come back sorted by key.
+	check("resource", s.Resource.Attributes(), []attribute.KeyValue{attribute.String("host", redactMask), mail})
+}
+
+func TestRedactRuleErrors(t *testing.T) {
+	t.Setenv(envRedactKey, "")
+	for _, rules := range []string{
+		`[{"key": "user", "action": "hash"}]`,
+		`[{"key": "user", "action": "encrypt"}]`,
+		`[{"action": "drop"}]`,
+		`[{"key": "user", "action": "drop", "scopes": ["trace"]}]`,
+		`[{"key_pattern": "(", "action": "drop"}]`,
+		`{"key": "user"}`,
+	} {
+		if _, err := loadRedactor(writeRules(t, rules), ""); err == nil {
+			t.Errorf("%s loaded without error", rules)
+		}
+	}
+	_, err := loadRedactor(writeRules(t, `[{"key": "user", "action": "hash"}]`), "")
+	if err == nil || !strings.Contains(err.Error(), "key") {
+		t.Errorf("hash rule without a key gave %v, want an error asking for the key", err)
+	}
+
+	t.Setenv(envRedactKey, "secret")
+	if _, err := loadRedactor(writeRules(t, `[{"key": "user", "action": "hash"}]`), ""); err != nil {
+		t.Errorf("key from the environment not used: %v", err)
+	}
+}
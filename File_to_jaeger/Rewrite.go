@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// rewriteRule is one entry of the rewrite rules file, for example
+//
+//	{"when": "service == \"sidecarservice\"", "action": "set", "scope": "resource", "key": "service.name", "value": "service3"}
+//	{"action": "set", "scope": "resource", "key": "deployment.environment", "value": "staging"}
+//	{"action": "name", "pattern": "^GET /users/\\d+$", "value": "GET /users/{id}"}
+//	{"action": "name", "value": "{{attr.http.method}} {{attr.http.route}}"}
+//	{"action": "rename", "key": "http.url", "to": "url.full"}
+//	{"action": "copy", "key": "peer.service", "to": "server.address"}
+//	{"action": "delete", "key": "thread.id"}
+//
+// Rules apply in order to the spans matching their when filter expression,
+// or to all spans without one. set, rename, copy and delete work on the span
+// attributes, or on the resource with "scope": "resource". name replaces the
+// span name, or with a pattern only what the pattern matches, where $1 refers
+// to a submatch. String values may refer to span fields as {{field}}, with
+// the field names of -filter.
+type rewriteRule struct {
+	When    string      `json:"when"`
+	Action  string      `json:"action"`
+	Scope   string      `json:"scope"`
+	Key     string      `json:"key"`
+	To      string      `json:"to"`
+	Value   interface{} `json:"value"`
+	Pattern string      `json:"pattern"`
+
+	when    filterExpr
+	pattern *regexp.Regexp
+}
+
+var templateField = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+type rewriter struct {
+	rules []rewriteRule
+}
+
+func loadRewriter(path string) (*rewriter, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &rewriter{}
+	if err := json.Unmarshal(b, &r.rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range r.rules {
+		if err := r.rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", path, i+1, err)
+		}
+	}
+	return r, nil
+}
+
+func (rule *rewriteRule) compile() error {
+	var err error
+	if rule.when, err = compileFilter(rule.When); err != nil {
+		return err
+	}
+	switch rule.Scope {
+	case "", scopeSpan, scopeResource:
+	default:
+		return fmt.Errorf("unknown scope %q", rule.Scope)
+	}
+
+	switch rule.Action {
+	case "set":
+		if rule.Key == "" || rule.Value == nil {
+			return errors.New("set needs a key and a value")
+		}
+		switch rule.Value.(type) {
+		case string, float64, bool:
+		default:
+			return fmt.Errorf("value of %q must be a string, number or boolean", rule.Key)
+		}
+	case "rename", "copy":
+		if rule.Key == "" || rule.To == "" {
+			return fmt.Errorf("%s needs a key and a to", rule.Action)
+		}
+	case "delete":
+		if rule.Key == "" {
+			return errors.New("delete needs a key")
+		}
+	case "name":
+		if _, ok := rule.Value.(string); !ok {
+			return errors.New("name needs a string value")
+		}
+		if rule.Pattern != "" {
+			if rule.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+	return nil
+}
+
+// apply runs the rules over s.
+func (r *rewriter) apply(s *tracetest.SpanStub) {
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.when != nil && !rule.when.eval(*s) {
+			continue
+		}
+		if rule.Action == "name" {
+			tmpl := rule.Value.(string)
+			if rule.pattern != nil {
+				// A "$" in a field value is not a submatch reference.
+				repl := expandFields(*s, tmpl, func(v string) string { return strings.ReplaceAll(v, "$", "$$") })
+				s.Name = rule.pattern.ReplaceAllString(s.Name, repl)
+			} else {
+				s.Name = expandTemplate(*s, tmpl)
+			}
+			continue
+		}
+
+		if rule.Scope == scopeResource {
+			var kvs []attribute.KeyValue
+			if s.Resource != nil {
+				kvs = s.Resource.Attributes()
+			}
+			s.Resource = resource.NewSchemaless(rule.rewrite(*s, kvs)...)
+		} else {
+			s.Attributes = rule.rewrite(*s, s.Attributes)
+		}
+	}
+}
+
+// rewrite returns kvs with the set, rename, copy or delete of rule applied.
+// kvs itself is not modified, since it may be shared with other spans.
+func (rule *rewriteRule) rewrite(s tracetest.SpanStub, kvs []attribute.KeyValue) []attribute.KeyValue {
+	var v attribute.Value
+	found := false
+	for _, kv := range kvs {
+		if string(kv.Key) == rule.Key {
+			v, found = kv.Value, true
+		}
+	}
+	if !found && rule.Action != "set" {
+		return kvs
+	}
+
+	// The attribute written, which replaces any existing one.
+	target := rule.To
+	if rule.Action == "set" {
+		target = rule.Key
+	}
+	out := make([]attribute.KeyValue, 0, len(kvs)+1)
+	for _, kv := range kvs {
+		k := string(kv.Key)
+		if k == target || k == rule.Key && (rule.Action == "rename" || rule.Action == "delete") {
+			continue
+		}
+		out = append(out, kv)
+	}
+
+	switch rule.Action {
+	case "set":
+		out = append(out, attribute.KeyValue{Key: attribute.Key(rule.Key), Value: rule.value(s)})
+	case "rename", "copy":
+		out = append(out, attribute.KeyValue{Key: attribute.Key(rule.To), Value: v})
+	}
+	return out
+}
+
+func (rule *rewriteRule) value(s tracetest.SpanStub) attribute.Value {
+	switch v := rule.Value.(type) {
+	case bool:
+		return attribute.BoolValue(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return attribute.Int64Value(int64(v))
+		}
+		return attribute.Float64Value(v)
+	}
+	return attribute.StringValue(expandTemplate(s, rule.Value.(string)))
+}
+
+// expandTemplate replaces each {{field}} in tmpl with the value of the field
+// in s, or nothing if s does not have it.
+func expandTemplate(s tracetest.SpanStub, tmpl string) string {
+	return expandFields(s, tmpl, func(v string) string { return v })
+}
+
+// expandFields is expandTemplate with every field value passed through
+// quote first.
+func expandFields(s tracetest.SpanStub, tmpl string, quote func(string) string) string {
+	return templateField.ReplaceAllStringFunc(tmpl, func(m string) string {
+		v, ok := fieldValue(s, templateField.FindStringSubmatch(m)[1])
+		if !ok {
+			return ""
+		}
+		return quote(v.str)
+	})
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRewriteNameKeepsDollarsInFields(t *testing.T) {
+	r, err := loadRewriter(writeRules(t, `[
+		{"action": "name", "pattern": "^GET /users/(\\d+)$", "value": "GET {{attr.tenant}} user $1"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := tracetest.SpanStub{
+		Name:       "GET /users/42",
+		Attributes: []attribute.KeyValue{attribute.String("tenant", "a$1b${2}")},
+	}
+	r.apply(&s)
+	if want := "GET a$1b${2} user 42"; s.Name != want {
+		t.Errorf("name is %q, want %q", s.Name, want)
+	}
+}
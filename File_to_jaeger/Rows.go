@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// defaultColumns are the columns of the csv and ndjson outputs when
+// -columns is not given.
+var defaultColumns = []string{
+	"trace_id", "span_id", "parent_span_id", "service", "name", "kind",
+	"start", "end", "duration_ns", "status",
+}
+
+// parseColumns parses -columns: a comma separated list of default columns,
+// attr.<key> and resource.<key>. A list starting with "+" adds to the
+// default columns instead of replacing them.
+func parseColumns(spec string) ([]string, error) {
+	var cols []string
+	if rest, ok := strings.CutPrefix(spec, "+"); ok {
+		cols = append(cols, defaultColumns...)
+		spec = rest
+	}
+	for _, c := range strings.Split(spec, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !isColumn(c) {
+			return nil, fmt.Errorf("unknown column %q", c)
+		}
+		cols = append(cols, c)
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns in %q", spec)
+	}
+	return cols, nil
+}
+
+func isColumn(c string) bool {
+	for _, d := range defaultColumns {
+		if c == d {
+			return true
+		}
+	}
+	return strings.HasPrefix(c, "attr.") || strings.HasPrefix(c, "resource.")
+}
+
+// columnValue returns column c of s, or nil if s has no such attribute.
+// Numbers and booleans keep their type for ndjson.
+func columnValue(s tracetest.SpanStub, c string) interface{} {
+	switch c {
+	case "trace_id":
+		return s.SpanContext.TraceID().String()
+	case "span_id":
+		return s.SpanContext.SpanID().String()
+	case "parent_span_id":
+		if !s.Parent.IsValid() {
+			return nil
+		}
+		return s.Parent.SpanID().String()
+	case "service":
+		return serviceName(s)
+	case "name":
+		return s.Name
+	case "kind":
+		return s.SpanKind.String()
+	case "start":
+		return s.StartTime.Format(time.RFC3339Nano)
+	case "end":
+		return s.EndTime.Format(time.RFC3339Nano)
+	case "duration_ns":
+		return s.EndTime.Sub(s.StartTime).Nanoseconds()
+	case "status":
+		return s.Status.Code.String()
+	}
+
+	var v attribute.Value
+	ok := false
+	if key, found := strings.CutPrefix(c, "attr."); found {
+		for _, kv := range s.Attributes {
+			if string(kv.Key) == key {
+				v, ok = kv.Value, true
+			}
+		}
+	} else if s.Resource != nil {
+		v, ok = s.Resource.Set().Value(attribute.Key(strings.TrimPrefix(c, "resource.")))
+	}
+	if !ok {
+		return nil
+	}
+	return v.AsInterface()
+}
+
+// rowExporter writes each span as one row as soon as it is exported.
+type rowExporter struct {
+	columns []string
+	row     func([]interface{}) error
+	flush   func() error
+	f       *os.File
+
+	mu sync.Mutex
+}
+
+// newRowExporter writes rows of the given columns to path, or standard
+// output for "-", as CSV with a header line or as one JSON object per line.
+// With appendRows the rows go after those of earlier runs, and the header is
+// only written to an empty file.
+func newRowExporter(path, format string, columns []string, appendRows bool) (*rowExporter, error) {
+	e := &rowExporter{columns: columns}
+	var w io.Writer = os.Stdout
+	header := true
+	if path != "-" {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if appendRows {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(path, flags, 0666)
+		if err != nil {
+			return nil, err
+		}
+		st, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		header = st.Size() == 0
+		e.f = f
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(bw)
+		rec := make([]string, len(columns))
+		e.row = func(vals []interface{}) error {
+			for i, v := range vals {
+				rec[i] = csvField(v)
+			}
+			return cw.Write(rec)
+		}
+		e.flush = func() error {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}
+		if header {
+			// Written out right away, so an output that cannot be
+			// written fails the run before any input is read.
+			err := cw.Write(columns)
+			if err == nil {
+				err = e.flush()
+			}
+			if err != nil {
+				e.Shutdown(context.Background())
+				return nil, err
+			}
+		}
+	case "ndjson":
+		enc := json.NewEncoder(bw)
+		e.row = func(vals []interface{}) error {
+			obj := make(map[string]interface{}, len(vals))
+			for i, v := range vals {
+				obj[columns[i]] = v
+			}
+			return enc.Encode(obj)
+		}
+		e.flush = bw.Flush
+	}
+	return e, nil
+}
+
+func csvField(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []bool, []int64, []float64, []string:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+func (e *rowExporter) ExportSpans(ctx context.Context, spans []tracesdk.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	vals := make([]interface{}, len(e.columns))
+	for _, s := range tracetest.SpanStubsFromReadOnlySpans(spans) {
+		for i, c := range e.columns {
+			vals[i] = columnValue(s, c)
+		}
+		if err := e.row(vals); err != nil {
+			return err
+		}
+	}
+	// Rows are written out with every batch so -follow output can be
+	// tailed.
+	return e.flush()
+}
+
+func (e *rowExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	err := e.flush()
+	if e.f != nil {
+		if cerr := e.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCSVAppendsWithCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.txt"), filepath.Join(dir, "out.csv")
+	args := []string{"-output", "csv", "-endpoint", out, "-checkpoint", filepath.Join(dir, "cp.json"), in}
+	exportRun := func() [][]string {
+		t.Helper()
+		cfg, err := parseConfig("export", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := runExport(cfg); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		rows, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	appendFile(t, in, spanLines(t, 2))
+	if rows := exportRun(); len(rows) != 3 {
+		t.Fatalf("first run left %d lines, want a header and 2 rows", len(rows))
+	}
+	appendFile(t, in, spanLines(t, 1))
+	rows := exportRun()
+	if len(rows) != 4 {
+		t.Fatalf("second run left %d lines, want a header and 3 rows", len(rows))
+	}
+	if rows[0][0] != "trace_id" || rows[3][0] == "trace_id" {
+		t.Errorf("want one header line first, got %v", rows)
+	}
+}
+
+func TestCSVHeaderWriteFails(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	if _, err := newRowExporter("/dev/full", "csv", defaultColumns, false); err == nil {
+		t.Error("no error for a header that cannot be written")
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// samplingPolicy decides, once a trace is assembled, whether all of it is
+// exported. A trace is never exported in part.
+type samplingPolicy interface {
+	keep(t *assembledTrace) bool
+}
+
+// anyPolicy keeps a trace that any of its policies keeps.
+type anyPolicy []samplingPolicy
+
+func (p anyPolicy) keep(t *assembledTrace) bool {
+	for _, q := range p {
+		if q.keep(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// allPolicy keeps a trace that all of its policies keep. Rate limits are
+// only charged for traces that all the other policies keep, so the order of
+// the policies does not matter.
+type allPolicy []samplingPolicy
+
+func (p allPolicy) keep(t *assembledTrace) bool {
+	var limits []*rateLimitPolicy
+	for _, q := range p {
+		if r, ok := q.(*rateLimitPolicy); ok {
+			if !r.allows(t) {
+				return false
+			}
+			limits = append(limits, r)
+			continue
+		}
+		if !q.keep(t) {
+			return false
+		}
+	}
+	for _, r := range limits {
+		r.keep(t)
+	}
+	return true
+}
+
+// errorPolicy keeps traces with at least one span with an Error status.
+type errorPolicy struct{}
+
+func (errorPolicy) keep(t *assembledTrace) bool {
+	for _, s := range t.spans {
+		if s.Status.Code == codes.Error {
+			return true
+		}
+	}
+	return false
+}
+
+// latencyPolicy keeps traces that last longer than min, from the earliest
+// span start to the latest span end.
+type latencyPolicy struct{ min time.Duration }
+
+func (p latencyPolicy) keep(t *assembledTrace) bool {
+	return traceDuration(t.spans) > p.min
+}
+
+func traceDuration(spans tracetest.SpanStubs) time.Duration {
+	if len(spans) == 0 {
+		return 0
+	}
+	start, end := spans[0].StartTime, spans[0].EndTime
+	for _, s := range spans[1:] {
+		if s.StartTime.Before(start) {
+			start = s.StartTime
+		}
+		if s.EndTime.After(end) {
+			end = s.EndTime
+		}
+	}
+	return end.Sub(start)
+}
+
+// probabilisticPolicy keeps a fixed fraction of traces, decided from the
+// trace ID the same way the SDK's TraceIDRatioBased sampler does, so the
+// same traces are kept on every run.
+type probabilisticPolicy struct{ bound uint64 }
+
+func newProbabilisticPolicy(fraction float64) probabilisticPolicy {
+	return probabilisticPolicy{bound: uint64(fraction * (1 << 63))}
+}
+
+func (p probabilisticPolicy) keep(t *assembledTrace) bool {
+	x := binary.BigEndian.Uint64(t.id[8:16]) >> 1
+	return x < p.bound
+}
+
+// rateLimitPolicy keeps at most perSecond traces per service for every
+// second of recorded time. A trace belongs to the service of its root span.
+type rateLimitPolicy struct {
+	perSecond int
+	seen      map[rateKey]int
+}
+
+type rateKey struct {
+	service string
+	second  int64
+}
+
+func (p *rateLimitPolicy) keep(t *assembledTrace) bool {
+	if !p.allows(t) {
+		return false
+	}
+	p.seen[rateKeyOf(t)]++
+	return true
+}
+
+// allows reports whether t fits in the limit without charging for it.
+func (p *rateLimitPolicy) allows(t *assembledTrace) bool {
+	return p.seen[rateKeyOf(t)] < p.perSecond
+}
+
+func rateKeyOf(t *assembledTrace) rateKey {
+	root := rootSpan(t.spans)
+	return rateKey{serviceName(root), root.StartTime.Unix()}
+}
+
+// rootSpan returns the first span without a valid parent, or the first span
+// if the root is missing.
+func rootSpan(spans tracetest.SpanStubs) tracetest.SpanStub {
+	for _, s := range spans {
+		if !s.Parent.IsValid() {
+			return s
+		}
+	}
+	return spans[0]
+}
+
+// parseSampling parses a sampling spec: policies separated by commas, of
+// which any may keep a trace, where each policy may join several with "&"
+// that must all keep it. The policies are
+//
+//	errors               traces with an Error status
+//	latency=DURATION     traces longer than DURATION
+//	probabilistic=RATIO  a RATIO between 0 and 1 of the traces
+//	rate-limit=N         at most N traces per service per second
+//
+// For example "errors,latency=500ms,probabilistic=0.05&rate-limit=10".
+func parseSampling(spec string) (samplingPolicy, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var alts anyPolicy
+	for _, alt := range strings.Split(spec, ",") {
+		var all allPolicy
+		for _, part := range strings.Split(alt, "&") {
+			p, err := parsePolicy(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("sampling policy %q: %w", part, err)
+			}
+			all = append(all, p)
+		}
+		if len(all) == 1 {
+			alts = append(alts, all[0])
+		} else {
+			alts = append(alts, all)
+		}
+	}
+	return alts, nil
+}
+
+func parsePolicy(s string) (samplingPolicy, error) {
+	name, arg, _ := strings.Cut(s, "=")
+	switch name {
+	case "errors":
+		return errorPolicy{}, nil
+	case "latency":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return nil, err
+		}
+		return latencyPolicy{d}, nil
+	case "probabilistic":
+		f, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, err
+		}
+		if f < 0 || f > 1 {
+			return nil, fmt.Errorf("ratio %v is not between 0 and 1", f)
+		}
+		return newProbabilisticPolicy(f), nil
+	case "rate-limit":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("negative rate %d", n)
+		}
+		return &rateLimitPolicy{perSecond: n, seen: map[rateKey]int{}}, nil
+	}
+	return nil, fmt.Errorf("unknown policy %q", name)
+}
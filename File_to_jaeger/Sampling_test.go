@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSampling(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// tr builds a one span trace of service svc whose trace ID ends in id,
+	// starting at second sec.
+	tr := func(svc string, id byte, sec int, d time.Duration, failed bool) *assembledTrace {
+		tid := trace.TraceID{1, 8: id, 9: id, 15: id}
+		s := tracetest.SpanStub{
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: trace.SpanID{1}}),
+			StartTime:   base.Add(time.Duration(sec) * time.Second),
+			Resource:    resource.NewSchemaless(attribute.String("service.name", svc)),
+		}
+		s.EndTime = s.StartTime.Add(d)
+		if failed {
+			s.Status.Code = codes.Error
+		}
+		return &assembledTrace{id: tid, spans: tracetest.SpanStubs{s}}
+	}
+	ok := tr("a", 0, 0, time.Millisecond, false)
+	failed := tr("a", 0, 0, time.Millisecond, true)
+	slow := tr("a", 0, 0, 2*time.Second, false)
+
+	for _, tc := range []struct {
+		spec   string
+		traces []*assembledTrace
+		want   []bool
+	}{
+		{"errors", []*assembledTrace{ok, failed}, []bool{false, true}},
+		{"latency=1s", []*assembledTrace{ok, slow}, []bool{false, true}},
+		{"errors,latency=1s", []*assembledTrace{ok, failed, slow}, []bool{false, true, true}},
+		{"errors&latency=1s", []*assembledTrace{failed, slow, tr("a", 0, 0, 2*time.Second, true)}, []bool{false, false, true}},
+		// A trace another part rejects leaves the rate limit alone,
+		// whichever order the parts are in.
+		{"rate-limit=1&errors", []*assembledTrace{ok, failed, failed}, []bool{false, true, false}},
+		{"errors&rate-limit=1", []*assembledTrace{ok, failed, failed}, []bool{false, true, false}},
+		// Every service gets its own budget for every second.
+		{"rate-limit=1", []*assembledTrace{
+			tr("a", 0, 0, 0, false), tr("a", 0, 0, 0, false), tr("b", 0, 0, 0, false), tr("a", 0, 1, 0, false),
+		}, []bool{true, false, true, true}},
+		{"rate-limit=0", []*assembledTrace{ok}, []bool{false}},
+		{"probabilistic=0", []*assembledTrace{tr("a", 0, 0, 0, false), tr("a", 0xff, 0, 0, false)}, []bool{false, false}},
+		{"probabilistic=1", []*assembledTrace{tr("a", 0, 0, 0, false), tr("a", 0xff, 0, 0, false)}, []bool{true, true}},
+		{"probabilistic=0.5", []*assembledTrace{tr("a", 0x10, 0, 0, false), tr("a", 0xf0, 0, 0, false)}, []bool{true, false}},
+	} {
+		p, err := parseSampling(tc.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		for i, at := range tc.traces {
+			if got := p.keep(at); got != tc.want[i] {
+				t.Errorf("%s: trace %d kept %v, want %v", tc.spec, i, got, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestParseSamplingErrors(t *testing.T) {
+	if p, err := parseSampling(" "); p != nil || err != nil {
+		t.Errorf("empty spec gave %v, %v, want no policy", p, err)
+	}
+	for _, spec := range []string{"latency=soon", "probabilistic=1.5", "probabilistic=-0.1", "rate-limit=-1", "rate-limit=x", "head", "errors,"} {
+		if _, err := parseSampling(spec); err == nil {
+			t.Errorf("%q parsed without error", spec)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// assembledTrace holds the spans of one trace in start time order.
+type assembledTrace struct {
+	id    trace.TraceID
+	spans tracetest.SpanStubs
+}
+
+// assemble groups spans into traces, ordered by their earliest start time.
+// It reorders spans in place.
+func assemble(spans tracetest.SpanStubs) []*assembledTrace {
+	mergeTraces(spans)
+	var traces []*assembledTrace
+	for i := 0; i < len(spans); {
+		id := spans[i].SpanContext.TraceID()
+		j := i + 1
+		for j < len(spans) && spans[j].SpanContext.TraceID() == id {
+			j++
+		}
+		traces = append(traces, &assembledTrace{id: id, spans: spans[i:j:j]})
+		i = j
+	}
+	return traces
+}
+
+// Kinds of problem found by checkTrace.
+const (
+	issueOrphan           = "orphan"
+	issueDuplicateSpanID  = "duplicate-span-id"
+	issueCycle            = "cycle"
+	issueChildBeforeStart = "child-before-parent"
+	issueEventOutside     = "event-outside-span"
+	issueChildCount       = "child-count-mismatch"
+)
+
+// issue is one integrity problem in a trace.
+type issue struct {
+	Kind    string `json:"kind"`
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+	Span    string `json:"span,omitempty"`
+	Message string `json:"message"`
+}
+
+// checkTrace reports orphan spans, duplicate span IDs, parent cycles,
+// children that start before their parent, events outside their span and
+// ChildSpanCount values that do not match the children in the trace.
+func checkTrace(t *assembledTrace) []issue {
+	var issues []issue
+	report := func(kind string, s tracetest.SpanStub, format string, args ...interface{}) {
+		issues = append(issues, issue{
+			Kind:    kind,
+			TraceID: t.id.String(),
+			SpanID:  s.SpanContext.SpanID().String(),
+			Span:    s.Name,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	byID := map[trace.SpanID]int{}
+	for i, s := range t.spans {
+		id := s.SpanContext.SpanID()
+		if _, dup := byID[id]; dup {
+			report(issueDuplicateSpanID, s, "span ID %s is used more than once", id)
+			continue
+		}
+		byID[id] = i
+	}
+	unique := func(i int) bool { return byID[t.spans[i].SpanContext.SpanID()] == i }
+
+	// ChildSpanCount only counts children started in the same process, so
+	// children of a remote parent are left out.
+	children := map[trace.SpanID]int{}
+	for i, s := range t.spans {
+		if !unique(i) || !s.Parent.IsValid() {
+			continue
+		}
+		pi, ok := byID[s.Parent.SpanID()]
+		if !ok || s.Parent.TraceID() != t.id {
+			report(issueOrphan, s, "parent %s is not in the trace", s.Parent.SpanID())
+			continue
+		}
+		if !s.Parent.IsRemote() {
+			children[s.Parent.SpanID()]++
+		}
+		if p := t.spans[pi]; s.StartTime.Before(p.StartTime) {
+			report(issueChildBeforeStart, s, "starts %s before its parent %q", p.StartTime.Sub(s.StartTime), p.Name)
+		}
+	}
+
+	for i, s := range t.spans {
+		if !unique(i) {
+			continue
+		}
+		if n := children[s.SpanContext.SpanID()]; n != s.ChildSpanCount {
+			report(issueChildCount, s, "ChildSpanCount is %d but %d children were found", s.ChildSpanCount, n)
+		}
+		for _, e := range s.Events {
+			if e.Time.Before(s.StartTime) || e.Time.After(s.EndTime) {
+				report(issueEventOutside, s, "event %q at %s is outside the span", e.Name, e.Time)
+			}
+		}
+	}
+
+	// Walk up from every span; reaching a span already on the current path
+	// means the parents form a cycle.
+	const (
+		onPath = 1
+		done   = 2
+	)
+	state := map[trace.SpanID]int{}
+	for i, s := range t.spans {
+		if !unique(i) {
+			continue
+		}
+		var path []trace.SpanID
+		for id := s.SpanContext.SpanID(); state[id] != done; {
+			if state[id] == onPath {
+				report(issueCycle, t.spans[byID[id]], "span is its own ancestor")
+				break
+			}
+			state[id] = onPath
+			path = append(path, id)
+			cur := t.spans[byID[id]]
+			next, ok := byID[cur.Parent.SpanID()]
+			if !cur.Parent.IsValid() || !ok {
+				break
+			}
+			id = t.spans[next].SpanContext.SpanID()
+		}
+		for _, id := range path {
+			state[id] = done
+		}
+	}
+	return issues
+}
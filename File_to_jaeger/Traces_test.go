@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCheckTrace(t *testing.T) {
+	tid := trace.TraceID{1}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := func(sid byte, remote bool) trace.SpanContext {
+		return trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: trace.SpanID{sid}, Remote: remote})
+	}
+	span := func(name string, sid, parent byte, start, end time.Duration, children int) tracetest.SpanStub {
+		s := tracetest.SpanStub{
+			Name:           name,
+			SpanContext:    ctx(sid, false),
+			StartTime:      base.Add(start),
+			EndTime:        base.Add(end),
+			ChildSpanCount: children,
+		}
+		if parent != 0 {
+			s.Parent = ctx(parent, false)
+		}
+		return s
+	}
+
+	// The root has ok, early and events as local children, not 2.
+	root := span("root", 1, 0, 0, 10*time.Second, 2)
+	// ok is counted by the root; remote has a remote parent and is not.
+	ok := span("ok", 2, 1, time.Second, 2*time.Second, 0)
+	remote := span("remote", 3, 1, time.Second, 2*time.Second, 0)
+	remote.Parent = ctx(1, true)
+	early := span("early", 4, 1, -time.Second, time.Second, 0)
+	orphan := span("orphan", 5, 9, time.Second, 2*time.Second, 0)
+	dup := span("dup", 2, 1, time.Second, 2*time.Second, 0)
+	cycleA := span("cycleA", 6, 7, time.Second, 2*time.Second, 1)
+	cycleB := span("cycleB", 7, 6, time.Second, 2*time.Second, 1)
+	events := span("events", 8, 1, time.Second, 2*time.Second, 0)
+	events.Events = []tracesdk.Event{
+		{Name: "inside", Time: base.Add(time.Second)},
+		{Name: "after", Time: base.Add(3 * time.Second)},
+	}
+	issues := checkTrace(&assembledTrace{id: tid, spans: tracetest.SpanStubs{
+		root, ok, remote, early, orphan, dup, cycleA, cycleB, events,
+	}})
+
+	var got []string
+	for _, is := range issues {
+		got = append(got, is.Kind+" "+is.Span)
+		if is.TraceID != tid.String() || is.Message == "" {
+			t.Errorf("issue %+v lacks its trace ID or message", is)
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		issueChildBeforeStart + " early",
+		issueChildCount + " root",
+		issueCycle + " cycleA",
+		issueDuplicateSpanID + " dup",
+		issueEventOutside + " events",
+		issueOrphan + " orphan",
+	}
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("got issues %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got issues %v, want %v", got, want)
+			break
+		}
+	}
+
+	// Counting the remote child as well would flag the root with 4.
+	root.ChildSpanCount = 3
+	for _, is := range checkTrace(&assembledTrace{id: tid, spans: tracetest.SpanStubs{root, ok, remote, early, events}}) {
+		if is.Kind == issueChildCount {
+			t.Errorf("remote child counted: %s", is.Message)
+		}
+	}
+}
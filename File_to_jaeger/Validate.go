@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// validateReport is what validate prints. Integrity problems that make a
+// trace wrong are errors; those that also come from clock skew or partial
+// recordings, and attributes dropped during conversion, are warnings.
+type validateReport struct {
+	OK       bool                      `json:"ok"`
+	Spans    int                       `json:"spans"`
+	Traces   int                       `json:"traces"`
+	Services map[string]*serviceCounts `json:"services"`
+	Errors   []issue                   `json:"errors"`
+	Warnings []issue                   `json:"warnings"`
+	Rejected []deadRecord              `json:"rejected"`
+}
+
+type serviceCounts struct {
+	Spans  int `json:"spans"`
+	Traces int `json:"traces"`
+	Errors int `json:"errors"`
+}
+
+// issueConversion is a warning raised while converting a span.
+const issueConversion = "conversion"
+
+var errorIssues = map[string]bool{
+	issueDuplicateSpanID: true,
+	issueCycle:           true,
+}
+
+// runValidate decodes, converts and checks the inputs without exporting
+// anything. It fails if any record is rejected or any trace has errors.
+func runValidate(cfg config) error {
+	dl, err := openDeadLetter(cfg.deadLetter)
+	if err != nil {
+		return err
+	}
+	defer dl.Close()
+	dl.keep = true
+
+	rep := validateReport{
+		Services: map[string]*serviceCounts{},
+		Errors:   []issue{},
+		Warnings: []issue{},
+	}
+	defer func(w func(string, ...interface{})) { warnf = w }(warnf)
+	warnf = func(format string, args ...interface{}) {
+		rep.Warnings = append(rep.Warnings, issue{Kind: issueConversion, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var all tracetest.SpanStubs
+	err = eachSpan(cfg.inputs, cfg.rotated, dl, func(s tracetest.SpanStub) error {
+		all = append(all, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	traces := assemble(all)
+	for _, t := range traces {
+		seen := map[string]bool{}
+		for _, s := range t.spans {
+			name := serviceName(s)
+			c := rep.Services[name]
+			if c == nil {
+				c = &serviceCounts{}
+				rep.Services[name] = c
+			}
+			c.Spans++
+			if s.Status.Code == codes.Error {
+				c.Errors++
+			}
+			if !seen[name] {
+				seen[name] = true
+				c.Traces++
+			}
+		}
+		for _, is := range checkTrace(t) {
+			if errorIssues[is.Kind] {
+				rep.Errors = append(rep.Errors, is)
+			} else {
+				rep.Warnings = append(rep.Warnings, is)
+			}
+		}
+	}
+	rep.Spans = len(all)
+	rep.Traces = len(traces)
+	rep.Rejected = append([]deadRecord{}, dl.rejected...)
+	rep.OK = len(rep.Errors) == 0 && len(rep.Rejected) == 0
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rep); err != nil {
+		return err
+	}
+	if !rep.OK {
+		return fmt.Errorf("validation failed: %d errors, %d records rejected", len(rep.Errors), len(rep.Rejected))
+	}
+	return nil
+}